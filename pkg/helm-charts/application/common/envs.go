@@ -6,6 +6,31 @@ const (
 	Environment             EnvironmentVariable = "ENVIRONMENT"
 	Port                    EnvironmentVariable = "PORT"
 	JaegerCollectorEndpoint EnvironmentVariable = "JAEGER_ENDPOINT"
+	MaxUploadSize           EnvironmentVariable = "MAX_UPLOAD_SIZE"
+	RegistryConfig          EnvironmentVariable = "REGISTRY_CONFIG"
+	CachePath               EnvironmentVariable = "CACHE_PATH"
+	CacheMemoryEntries      EnvironmentVariable = "CACHE_MEMORY_ENTRIES"
+	CacheTagTTL             EnvironmentVariable = "CACHE_TAG_TTL"
+	ChartCacheTTL           EnvironmentVariable = "CHART_CACHE_TTL"
+	ChartCacheMaxSize       EnvironmentVariable = "CHART_CACHE_MAX_SIZE"
+	AdminToken              EnvironmentVariable = "ADMIN_TOKEN"
+	LookupConcurrency       EnvironmentVariable = "LOOKUP_CONCURRENCY"
+	LookupTimeout           EnvironmentVariable = "LOOKUP_TIMEOUT"
+	ScanConcurrency         EnvironmentVariable = "SCAN_CONCURRENCY"
+	ScanRetention           EnvironmentVariable = "SCAN_RETENTION"
+	MaxQueuedScans          EnvironmentVariable = "MAX_QUEUED_SCANS"
+	BatchConcurrency        EnvironmentVariable = "BATCH_CONCURRENCY"
+	MaxBatchSize            EnvironmentVariable = "MAX_BATCH_SIZE"
+	TrustedSources          EnvironmentVariable = "TRUSTED_SOURCES"
+	MaxRedirects            EnvironmentVariable = "MAX_REDIRECTS"
+	AllowedNetworks         EnvironmentVariable = "ALLOWED_NETWORKS"
+	DownloadTimeout         EnvironmentVariable = "DOWNLOAD_TIMEOUT"
+	MaxArchiveSize          EnvironmentVariable = "MAX_ARCHIVE_SIZE"
+	MaxDecompressedSize     EnvironmentVariable = "MAX_DECOMPRESSED_SIZE"
+	MaxArchiveFiles         EnvironmentVariable = "MAX_ARCHIVE_FILES"
+	MaxIndexSize            EnvironmentVariable = "MAX_INDEX_SIZE"
+	HelmRenderer            EnvironmentVariable = "HELM_RENDERER"
+	RenderConcurrency       EnvironmentVariable = "RENDER_CONCURRENCY"
 )
 
 // String converts environment variable to its string type
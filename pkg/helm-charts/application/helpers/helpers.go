@@ -2,9 +2,8 @@ package helpers
 
 import (
 	"fmt"
-	"net/url"
 	"os"
-	"strings"
+	"strconv"
 )
 
 // GetEnvVar retrieves the environment variable with the supplied name and fails
@@ -18,31 +17,18 @@ func GetEnvVar(envVarName string) (string, error) {
 	return envVar, nil
 }
 
-// Validate and sanitize the URL before making a request.
-func ValidateURL(userInputURL string) (string, error) {
-	parsedURL, err := url.Parse(userInputURL)
-	if err != nil {
-		return "", fmt.Errorf("invalid URL: %w", err)
-	}
-
-	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return "", fmt.Errorf("invalid URL scheme: only HTTP/HTTPS are allowed")
-	}
-
-	trustedDomains := []string{"bitnami.com", "helm.sh", "artifacthub.io", "hashicorp.com", "github.io", "jetstack.io", "github.com"}
-
-	isValidHost := false
-
-	for _, domain := range trustedDomains {
-		if strings.Contains(parsedURL.Host, domain) {
-			isValidHost = true
-			break
-		}
+// GetIntEnvVar retrieves an optional integer environment variable, falling back to
+// defaultValue when it is not set
+func GetIntEnvVar(envVarName string, defaultValue int64) (int64, error) {
+	envVar := os.Getenv(envVarName)
+	if envVar == "" {
+		return defaultValue, nil
 	}
 
-	if !isValidHost {
-		return "", fmt.Errorf("untrusted domain: %s", parsedURL.Host)
+	value, err := strconv.ParseInt(envVar, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("the environment variable '%s' must be an integer: %w", envVarName, err)
 	}
 
-	return parsedURL.String(), nil
+	return value, nil
 }
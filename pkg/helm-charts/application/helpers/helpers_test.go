@@ -50,6 +50,67 @@ func TestGetEnvVar(t *testing.T) {
 	}
 }
 
+func TestGetIntEnvVar(t *testing.T) {
+	type args struct {
+		envVarName   string
+		value        string
+		defaultValue int64
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		want    int64
+		wantErr bool
+	}{
+		{
+			name: "success: get int env",
+			args: args{
+				envVarName:   "TEST_INT_ENV",
+				value:        "1024",
+				defaultValue: 1,
+			},
+			want:    1024,
+			wantErr: false,
+		},
+		{
+			name: "success: fall back to default",
+			args: args{
+				envVarName:   "TEST_INT_ENV",
+				defaultValue: 1,
+			},
+			want:    1,
+			wantErr: false,
+		},
+		{
+			name: "fail: not an integer",
+			args: args{
+				envVarName:   "TEST_INT_ENV",
+				value:        "10MB",
+				defaultValue: 1,
+			},
+			want:    0,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.args.envVarName, tt.args.value)
+
+			got, err := GetIntEnvVar(tt.args.envVarName, tt.args.defaultValue)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetIntEnvVar() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("GetIntEnvVar() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestValidateURL(t *testing.T) {
 	type args struct {
 		userInputURL string
@@ -69,6 +130,14 @@ func TestValidateURL(t *testing.T) {
 			want:    "https://github.com",
 			wantErr: false,
 		},
+		{
+			name: "success: parse oci reference",
+			args: args{
+				userInputURL: "oci://registry-1.docker.io/bitnamicharts/redis:20.6.0",
+			},
+			want:    "oci://registry-1.docker.io/bitnamicharts/redis:20.6.0",
+			wantErr: false,
+		},
 		{
 			name: "fail: invalid url",
 			args: args{
@@ -85,6 +154,86 @@ func TestValidateURL(t *testing.T) {
 			want:    "",
 			wantErr: true,
 		},
+		{
+			name: "success: subdomain of trusted domain",
+			args: args{
+				userInputURL: "https://charts.bitnami.com/bitnami/index.yaml",
+			},
+			want:    "https://charts.bitnami.com/bitnami/index.yaml",
+			wantErr: false,
+		},
+		{
+			name: "fail: trusted domain as subdomain of lookalike",
+			args: args{
+				userInputURL: "https://github.com.evil.example/chart.tgz",
+			},
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name: "fail: trusted domain as suffix of lookalike",
+			args: args{
+				userInputURL: "https://evilgithub.com/chart.tgz",
+			},
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name: "fail: trusted domain as userinfo",
+			args: args{
+				userInputURL: "https://github.com@evil.example/chart.tgz",
+			},
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name: "fail: trusted domain in path",
+			args: args{
+				userInputURL: "https://evil.example/github.com/chart.tgz",
+			},
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name: "fail: registry as subdomain of lookalike",
+			args: args{
+				userInputURL: "oci://ghcr.io.evil.example/charts/redis:1.0.0",
+			},
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name: "fail: registry as suffix of lookalike",
+			args: args{
+				userInputURL: "oci://notdocker.io/charts/redis:1.0.0",
+			},
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name: "fail: subdomain of exact registry host",
+			args: args{
+				userInputURL: "oci://evil.docker.io/charts/redis:1.0.0",
+			},
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name: "fail: registry host over https",
+			args: args{
+				userInputURL: "https://ghcr.io/evil/chart.tgz",
+			},
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name: "fail: apex of subdomain only rule",
+			args: args{
+				userInputURL: "https://github.io/chart.tgz",
+			},
+			want:    "",
+			wantErr: true,
+		},
 		{
 			name: "fail: invalid scheme",
 			args: args{
@@ -0,0 +1,275 @@
+package helpers
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultTrustedHosts are the chart sources trusted when no source policy is configured
+var defaultTrustedHosts = []string{
+	"bitnami.com", "*.bitnami.com",
+	"helm.sh", "*.helm.sh",
+	"artifacthub.io", "*.artifacthub.io",
+	"hashicorp.com", "*.hashicorp.com",
+	"*.github.io",
+	"jetstack.io", "*.jetstack.io",
+	"github.com", "*.github.com",
+}
+
+// defaultTrustedRegistries are the OCI registries trusted when no source policy is configured. They
+// are trusted by their exact host, and only for oci:// references.
+var defaultTrustedRegistries = []string{"docker.io", "registry-1.docker.io", "ghcr.io"}
+
+// sourceSchemes are the URL schemes charts, repository indexes and values files are fetched with
+var sourceSchemes = []string{"http", "https", "oci"}
+
+// SourceRule matches URLs by host and, optionally, path. Host is either an exact host name or
+// "*." followed by a domain, which matches every subdomain of the domain but not the domain itself.
+// When Paths is set, only URLs whose path is one of the prefixes, or lies below one, match, and when
+// Schemes is set only URLs with one of the schemes do. Hosts always match regardless of case, paths
+// only when IgnoreCase is set, for servers such as github.com that treat paths case-insensitively.
+type SourceRule struct {
+	Host       string   `yaml:"host"`
+	Paths      []string `yaml:"paths"`
+	Schemes    []string `yaml:"schemes"`
+	IgnoreCase bool     `yaml:"ignore_case"`
+}
+
+// SourcePolicy decides which chart sources are trusted. A URL is trusted when it matches an Allow rule
+// and no Deny rule. IncludeDefaults adds the built in trusted sources to Allow.
+type SourcePolicy struct {
+	Allow           []SourceRule `yaml:"allow"`
+	Deny            []SourceRule `yaml:"deny"`
+	IncludeDefaults bool         `yaml:"include_defaults"`
+}
+
+// sourcePolicy is the policy ValidateURL enforces
+var sourcePolicy atomic.Pointer[SourcePolicy]
+
+func init() {
+	sourcePolicy.Store(DefaultSourcePolicy())
+}
+
+// DefaultSourcePolicy trusts the well known public chart hosts and their subdomains, and the public
+// OCI registries for oci:// references
+func DefaultSourcePolicy() *SourcePolicy {
+	policy := &SourcePolicy{}
+
+	for _, host := range defaultTrustedHosts {
+		policy.Allow = append(policy.Allow, SourceRule{Host: host})
+	}
+
+	for _, host := range defaultTrustedRegistries {
+		policy.Allow = append(policy.Allow, SourceRule{Host: host, Schemes: []string{"oci"}})
+	}
+
+	return policy
+}
+
+// SetSourcePolicy replaces the policy enforced by ValidateURL. It is meant to be called once at startup.
+func SetSourcePolicy(policy *SourcePolicy) {
+	sourcePolicy.Store(policy)
+}
+
+// LoadSourcePolicy reads and validates a source policy from a YAML file.
+func LoadSourcePolicy(filePath string) (*SourcePolicy, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source policy: %w", err)
+	}
+
+	policy := &SourcePolicy{}
+
+	if err := yaml.Unmarshal(content, policy); err != nil {
+		return nil, fmt.Errorf("invalid source policy: %w", err)
+	}
+
+	if policy.IncludeDefaults {
+		policy.Allow = append(DefaultSourcePolicy().Allow, policy.Allow...)
+	}
+
+	if len(policy.Allow) == 0 {
+		return nil, fmt.Errorf("invalid source policy: allow must list at least one source")
+	}
+
+	for _, rules := range [][]SourceRule{policy.Allow, policy.Deny} {
+		for i := range rules {
+			if err := rules[i].normalize(); err != nil {
+				return nil, fmt.Errorf("invalid source policy: %w", err)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// normalize lower cases the host and checks that the rule is well formed.
+func (r *SourceRule) normalize() error {
+	r.Host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(r.Host)), ".")
+
+	domain := strings.TrimPrefix(r.Host, "*.")
+
+	if domain == "" || strings.ContainsAny(domain, "*/:@ ") || strings.HasPrefix(domain, ".") {
+		return fmt.Errorf("invalid host %q: expected a host name or *.domain", r.Host)
+	}
+
+	for i, prefix := range r.Paths {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("invalid path %q for host %s: paths must start with /", prefix, r.Host)
+		}
+
+		r.Paths[i] = path.Clean(prefix)
+	}
+
+	for i, scheme := range r.Schemes {
+		r.Schemes[i] = strings.ToLower(strings.TrimSpace(scheme))
+
+		if !slices.Contains(sourceSchemes, r.Schemes[i]) {
+			return fmt.Errorf("invalid scheme %q for host %s: expected one of %s", scheme, r.Host, strings.Join(sourceSchemes, ", "))
+		}
+	}
+
+	return nil
+}
+
+// matchesHost reports whether host, lower cased and without a port, matches the rule.
+func (r *SourceRule) matchesHost(host string) bool {
+	if domain, ok := strings.CutPrefix(r.Host, "*."); ok {
+		return strings.HasSuffix(host, "."+domain)
+	}
+
+	return host == r.Host
+}
+
+// matches reports whether a URL with the given scheme, host and cleaned path matches the rule.
+// Path prefixes only match at a path segment boundary.
+func (r *SourceRule) matches(scheme, host, urlPath string) bool {
+	if !r.matchesHost(host) || (len(r.Schemes) > 0 && !slices.Contains(r.Schemes, scheme)) {
+		return false
+	}
+
+	if len(r.Paths) == 0 {
+		return true
+	}
+
+	if r.IgnoreCase {
+		urlPath = strings.ToLower(urlPath)
+	}
+
+	for _, prefix := range r.Paths {
+		if r.IgnoreCase {
+			prefix = strings.ToLower(prefix)
+		}
+
+		if prefix == "/" || urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String describes the rule as host or host/path for every path, followed by the schemes it is limited to.
+func (r SourceRule) String() string {
+	described := []string{r.Host}
+
+	if len(r.Paths) > 0 {
+		described = make([]string, len(r.Paths))
+
+		for i, prefix := range r.Paths {
+			described[i] = r.Host + prefix
+		}
+	}
+
+	if len(r.Schemes) == 0 {
+		return strings.Join(described, ", ")
+	}
+
+	return fmt.Sprintf("%s (%s only)", strings.Join(described, ", "), strings.Join(r.Schemes, ", "))
+}
+
+// String summarises the policy for logging.
+func (p *SourcePolicy) String() string {
+	describe := func(rules []SourceRule) string {
+		if len(rules) == 0 {
+			return "none"
+		}
+
+		described := make([]string, len(rules))
+
+		for i, rule := range rules {
+			described[i] = rule.String()
+		}
+
+		return strings.Join(described, ", ")
+	}
+
+	return fmt.Sprintf("allow: %s; deny: %s", describe(p.Allow), describe(p.Deny))
+}
+
+// ValidateURL checks that a URL uses HTTP(S) or OCI and comes from a source the policy trusts,
+// and returns it in its canonical form.
+func (p *SourcePolicy) ValidateURL(userInputURL string) (string, error) {
+	parsedURL, err := url.Parse(userInputURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+
+	if !slices.Contains(sourceSchemes, parsedURL.Scheme) {
+		return "", fmt.Errorf("invalid URL scheme: only HTTP/HTTPS/OCI are allowed")
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(parsedURL.Hostname()), ".")
+	if host == "" {
+		return "", fmt.Errorf("invalid URL: host is missing")
+	}
+
+	urlPath, err := sourcePath(parsedURL)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rule := range p.Deny {
+		if rule.matches(parsedURL.Scheme, host, urlPath) {
+			return "", fmt.Errorf("denied source: %s", parsedURL.Host)
+		}
+	}
+
+	for _, rule := range p.Allow {
+		if rule.matches(parsedURL.Scheme, host, urlPath) {
+			return parsedURL.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("untrusted domain: %s", parsedURL.Host)
+}
+
+// sourcePath returns the path rules are matched against. Paths with encoded separators or dot
+// segments are rejected, since the server may resolve them to another path than the one checked.
+func sourcePath(parsedURL *url.URL) (string, error) {
+	escaped := strings.ToLower(parsedURL.EscapedPath())
+
+	if strings.Contains(escaped, "%2f") || strings.Contains(escaped, "%5c") || strings.Contains(parsedURL.Path, `\`) {
+		return "", fmt.Errorf("invalid URL path: encoded path separators are not allowed")
+	}
+
+	for _, segment := range strings.Split(parsedURL.Path, "/") {
+		if segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid URL path: dot segments are not allowed")
+		}
+	}
+
+	return path.Clean("/" + parsedURL.Path), nil
+}
+
+// Validate and sanitize the URL before making a request, using the configured source policy.
+func ValidateURL(userInputURL string) (string, error) {
+	return sourcePolicy.Load().ValidateURL(userInputURL)
+}
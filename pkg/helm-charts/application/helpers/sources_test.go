@@ -0,0 +1,172 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSourcePolicy writes a source policy to a temporary file and returns its path.
+func writeSourcePolicy(t *testing.T, content string) string {
+	t.Helper()
+
+	policyPath := filepath.Join(t.TempDir(), "sources.yaml")
+
+	if err := os.WriteFile(policyPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write source policy: %v", err)
+	}
+
+	return policyPath
+}
+
+func TestSourcePolicy_ValidateURL(t *testing.T) {
+	policy, err := LoadSourcePolicy(writeSourcePolicy(t, `
+allow:
+  - host: charts.example.com
+    paths: ["/stable"]
+  - host: "*.Example.org."
+  - host: registry.example.com
+  - host: github.com
+  - host: oci.example.net
+    schemes: [OCI]
+deny:
+  - host: legacy.example.org
+  - host: registry.example.com
+    paths: ["/internal/"]
+  - host: github.com
+    paths: ["/untrusted-org"]
+    ignore_case: true
+`))
+	if err != nil {
+		t.Fatalf("LoadSourcePolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "success: path prefix", url: "https://charts.example.com/stable"},
+		{name: "success: below path prefix", url: "https://charts.example.com/stable/app-1.0.0.tgz"},
+		{name: "success: host is case insensitive", url: "https://CHARTS.example.com/stable/app.tgz"},
+		{name: "success: fully qualified host", url: "https://charts.example.com./stable/app.tgz"},
+		{name: "success: wildcard subdomain", url: "https://charts.example.org/app.tgz"},
+		{name: "success: nested wildcard subdomain", url: "https://a.b.example.org/app.tgz"},
+		{name: "success: oci reference", url: "oci://registry.example.com/charts/app:1.0.0"},
+		{name: "success: port is ignored", url: "oci://registry.example.com:5000/charts/app:1.0.0"},
+		{name: "fail: outside path prefix", url: "https://charts.example.com/incubator/app.tgz", wantErr: true},
+		{name: "fail: path prefix is not a segment", url: "https://charts.example.com/stable-evil/app.tgz", wantErr: true},
+		{name: "fail: path escapes prefix", url: "https://charts.example.com/stable/../private/app.tgz", wantErr: true},
+		{name: "fail: encoded slash escapes prefix", url: "https://charts.example.com/stable%2F..%2Fprivate/app.tgz", wantErr: true},
+		{name: "fail: lower case encoded slash", url: "https://charts.example.com/stable%2f..%2fprivate/app.tgz", wantErr: true},
+		{name: "fail: encoded backslash", url: "https://charts.example.com/stable%5C..%5Cprivate/app.tgz", wantErr: true},
+		{name: "fail: encoded dot segment", url: "https://charts.example.com/stable/%2E%2E/private/app.tgz", wantErr: true},
+		{name: "fail: current directory segment", url: "https://charts.example.com/stable/./app.tgz", wantErr: true},
+		{name: "success: other encoded characters", url: "https://charts.example.com/stable/app%20chart-1.0.0.tgz"},
+		{name: "fail: wildcard does not match apex", url: "https://example.org/app.tgz", wantErr: true},
+		{name: "fail: lookalike suffix", url: "https://charts.example.org.evil.example/app.tgz", wantErr: true},
+		{name: "fail: lookalike prefix", url: "https://evilexample.org/app.tgz", wantErr: true},
+		{name: "fail: default sources not included", url: "https://charts.bitnami.com/bitnami/index.yaml", wantErr: true},
+		{name: "fail: denied host", url: "https://legacy.example.org/app.tgz", wantErr: true},
+		{name: "fail: denied path", url: "oci://registry.example.com/internal/app:1.0.0", wantErr: true},
+		{name: "success: paths are case sensitive", url: "oci://registry.example.com/Internal/app:1.0.0"},
+		{name: "success: outside case insensitive path", url: "https://github.com/trusted-org/app.tgz"},
+		{name: "fail: denied path ignoring case", url: "https://github.com/Untrusted-Org/app.tgz", wantErr: true},
+		{name: "fail: denied path with matching case", url: "https://github.com/untrusted-org/app.tgz", wantErr: true},
+		{name: "success: scheme limited rule", url: "oci://oci.example.net/charts/app:1.0.0"},
+		{name: "fail: scheme outside rule", url: "https://oci.example.net/charts/app.tgz", wantErr: true},
+		{name: "fail: missing host", url: "https:///stable/app.tgz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := policy.ValidateURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SourcePolicy.ValidateURL(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadSourcePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantAllow int
+		wantErr   bool
+	}{
+		{
+			name:      "success: allow list",
+			content:   "allow:\n  - host: charts.example.com\n",
+			wantAllow: 1,
+		},
+		{
+			name:      "success: defaults included",
+			content:   "include_defaults: true\nallow:\n  - host: charts.example.com\n",
+			wantAllow: len(defaultTrustedHosts) + len(defaultTrustedRegistries) + 1,
+		},
+		{
+			name:      "success: defaults only",
+			content:   "include_defaults: true\ndeny:\n  - host: github.com\n",
+			wantAllow: len(defaultTrustedHosts) + len(defaultTrustedRegistries),
+		},
+		{
+			name:    "fail: empty allow list",
+			content: "deny:\n  - host: github.com\n",
+			wantErr: true,
+		},
+		{
+			name:    "fail: wildcard inside host",
+			content: "allow:\n  - host: charts.*.com\n",
+			wantErr: true,
+		},
+		{
+			name:    "fail: bare wildcard",
+			content: "allow:\n  - host: \"*\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "fail: host with scheme",
+			content: "allow:\n  - host: https://charts.example.com\n",
+			wantErr: true,
+		},
+		{
+			name:      "success: schemes",
+			content:   "allow:\n  - host: registry.example.com\n    schemes: [oci, https]\n",
+			wantAllow: 1,
+		},
+		{
+			name:    "fail: unsupported scheme",
+			content: "allow:\n  - host: registry.example.com\n    schemes: [ftp]\n",
+			wantErr: true,
+		},
+		{
+			name:    "fail: relative path",
+			content: "allow:\n  - host: charts.example.com\n    paths: [stable]\n",
+			wantErr: true,
+		},
+		{
+			name:    "fail: invalid yaml",
+			content: "allow: [",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadSourcePolicy(writeSourcePolicy(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadSourcePolicy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && len(got.Allow) != tt.wantAllow {
+				t.Errorf("LoadSourcePolicy() allow = %v, want %d rules", got.Allow, tt.wantAllow)
+			}
+		})
+	}
+
+	if _, err := LoadSourcePolicy(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("LoadSourcePolicy() of a missing file did not fail")
+	}
+}
@@ -0,0 +1,43 @@
+package domain
+
+// BatchInput lists the charts scanned by a single batch request, each with its own values
+type BatchInput struct {
+	Charts []HelmLinkInput `json:"charts"`
+}
+
+// BatchChartResult is the outcome of scanning one chart of a batch. Charts that could not be
+// scanned report the Error instead of a Result.
+type BatchChartResult struct {
+	Index  int              `json:"index"`
+	Result *ChartScanResult `json:"result,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+// BatchImage is an image referenced by one or more charts of a batch. Charts holds the
+// indexes of the charts that reference it.
+type BatchImage struct {
+	Reference string      `json:"reference"`
+	Digest    string      `json:"digest,omitempty"`
+	Status    ImageStatus `json:"status"`
+	Size      int64       `json:"size"`
+	Layers    int         `json:"layers"`
+	Charts    []int       `json:"charts"`
+}
+
+// BatchSummary aggregates the charts of a batch. TotalSize sums the size of every unique image
+// that was looked up successfully, counting images shared by several charts once.
+type BatchSummary struct {
+	Charts       int   `json:"charts"`
+	Succeeded    int   `json:"succeeded"`
+	Failed       int   `json:"failed"`
+	UniqueImages int   `json:"unique_images"`
+	TotalSize    int64 `json:"total_size"`
+}
+
+// BatchScanResult holds the result of every chart of a batch, in request order, and the
+// unique images across all of them.
+type BatchScanResult struct {
+	Summary *BatchSummary       `json:"summary"`
+	Charts  []*BatchChartResult `json:"charts"`
+	Images  []*BatchImage       `json:"images"`
+}
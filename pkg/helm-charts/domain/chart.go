@@ -1,8 +1,169 @@
 package domain
 
-// ImageDetails represents a base docker image
+import "time"
+
+// ContainerType distinguishes the container lists of a pod spec
+type ContainerType string
+
+const (
+	ContainerTypeInit      ContainerType = "init"
+	ContainerTypeRegular   ContainerType = "regular"
+	ContainerTypeEphemeral ContainerType = "ephemeral"
+)
+
+// ImageSource describes the template, resource and container that reference an image
+type ImageSource struct {
+	Template      string        `json:"template,omitempty"`
+	Kind          string        `json:"kind"`
+	Namespace     string        `json:"namespace,omitempty"`
+	Name          string        `json:"name"`
+	Container     string        `json:"container"`
+	ContainerType ContainerType `json:"container_type"`
+}
+
+// ImageStatus is the outcome of looking up an image in its registry
+type ImageStatus string
+
+const (
+	ImageStatusOK               ImageStatus = "ok"
+	ImageStatusNotFound         ImageStatus = "not_found"
+	ImageStatusUnauthorized     ImageStatus = "unauthorized"
+	ImageStatusRateLimited      ImageStatus = "rate_limited"
+	ImageStatusInvalidReference ImageStatus = "invalid_reference"
+	ImageStatusTimeout          ImageStatus = "timeout"
+	ImageStatusCanceled         ImageStatus = "canceled"
+	ImageStatusError            ImageStatus = "error"
+)
+
+// CacheStatus reports whether a result was served from a cache
+type CacheStatus string
+
+const (
+	CacheStatusHit  CacheStatus = "hit"
+	CacheStatusMiss CacheStatus = "miss"
+)
+
+// CachePurgeResult reports how many cache entries a purge removed
+type CachePurgeResult struct {
+	Purged int `json:"purged"`
+}
+
+// ImageDetails represents a base docker image. Image is the reference as first written in
+// the chart, Reference its fully qualified form, and Sources every place that uses it.
+// EffectiveReference is the reference actually looked up, which differs from Reference when
+// a mirror rule rewrote it; MirrorFallback reports that the mirror failed and upstream was used.
+// Digest is the manifest digest the reference resolved to, and Cache is set when the image cache is enabled.
+// Pinned is set when the chart references the image by digest rather than by a floating tag, and
+// PinnedReference is the repository pinned to Digest.
+// Size and Layers are only set when Status is ok, otherwise Error explains the failure.
 type ImageDetails struct {
-	Image  string `json:"image"`
-	Size   int64  `json:"size"`
-	Layers int    `json:"layers"`
+	Image              string            `json:"image"`
+	Reference          string            `json:"reference"`
+	EffectiveReference string            `json:"effective_reference"`
+	MirrorFallback     bool              `json:"mirror_fallback,omitempty"`
+	Digest             string            `json:"digest,omitempty"`
+	Pinned             bool              `json:"pinned"`
+	PinnedReference    string            `json:"pinned_reference,omitempty"`
+	Cache              CacheStatus       `json:"cache,omitempty"`
+	Status             ImageStatus       `json:"status"`
+	Error              string            `json:"error,omitempty"`
+	Size               int64             `json:"size"`
+	Layers             int               `json:"layers"`
+	Occurrences        int               `json:"occurrences"`
+	Sources            []ImageSource     `json:"sources,omitempty"`
+	Platforms          []PlatformDetails `json:"platforms,omitempty"`
+	LayerDetails       []ImageLayer      `json:"layer_details,omitempty"`
+	UncompressedSize   int64             `json:"uncompressed_size,omitempty"`
+	Config             *ImageConfig      `json:"config,omitempty"`
+}
+
+// ImageLayer is a compressed layer of an image. UncompressedSize is only measured on request.
+type ImageLayer struct {
+	Digest           string `json:"digest"`
+	Size             int64  `json:"size"`
+	UncompressedSize int64  `json:"uncompressed_size,omitempty"`
+}
+
+// ImageConfig is the runtime configuration of an image, read from its config blob. Annotations
+// are those of the image manifest, and of the index for multi-architecture images. RunsAsRoot
+// is set when User is empty or names the root user or UID 0.
+type ImageConfig struct {
+	Created      *time.Time        `json:"created,omitempty"`
+	OS           string            `json:"os"`
+	Architecture string            `json:"architecture"`
+	Variant      string            `json:"variant,omitempty"`
+	Entrypoint   []string          `json:"entrypoint,omitempty"`
+	Cmd          []string          `json:"cmd,omitempty"`
+	WorkingDir   string            `json:"working_dir,omitempty"`
+	ExposedPorts []string          `json:"exposed_ports,omitempty"`
+	User         string            `json:"user,omitempty"`
+	RunsAsRoot   bool              `json:"runs_as_root"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// PlatformDetails describes one platform of a multi-architecture image
+type PlatformDetails struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+	Digest       string `json:"digest"`
+	Size         int64  `json:"size"`
+	Layers       int    `json:"layers"`
+}
+
+// ScanSummary counts the image lookups of a scan by outcome
+type ScanSummary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+// ChartDetails describes the chart archive that was scanned. ArchiveCache reports whether a
+// downloaded archive was served from the chart cache after revalidating it, and RenderCache whether
+// its manifests were rendered before with the same values; both are only set when the cache is enabled.
+type ChartDetails struct {
+	URL          string      `json:"url,omitempty"`
+	Name         string      `json:"name,omitempty"`
+	Version      string      `json:"version,omitempty"`
+	Digest       string      `json:"digest"`
+	ArchiveCache CacheStatus `json:"archive_cache,omitempty"`
+	RenderCache  CacheStatus `json:"render_cache,omitempty"`
+}
+
+// ChartScanResult is the outcome of processing a Helm chart. Partial is set when the scan ran out
+// of time or was canceled before every image was looked up.
+type ChartScanResult struct {
+	Chart   *ChartDetails   `json:"chart"`
+	Partial bool            `json:"partial,omitempty"`
+	Summary *ScanSummary    `json:"summary"`
+	Layers  *LayerSummary   `json:"layers"`
+	Pinning *PinSuggestion  `json:"pinning,omitempty"`
+	Images  []*ImageDetails `json:"images"`
+}
+
+// PinSuggestion is a values override that pins the floating images of a chart to their digests.
+// Values is a YAML document for helm --values. Unpinned lists the floating images that could not
+// be mapped to a value of the chart, such as images set by a template or user supplied values.
+type PinSuggestion struct {
+	Values   string   `json:"values"`
+	Pinned   []string `json:"pinned"`
+	Unpinned []string `json:"unpinned"`
+}
+
+// SharedLayer is a layer used by more than one image of a chart, listed by reference
+type SharedLayer struct {
+	Digest string   `json:"digest"`
+	Size   int64    `json:"size"`
+	Images []string `json:"images"`
+}
+
+// LayerSummary estimates what a node without any of the images of a chart pulls. TotalSize sums
+// the size of every image, while UniqueSize counts layers shared by several images once.
+type LayerSummary struct {
+	TotalLayers  int           `json:"total_layers"`
+	UniqueLayers int           `json:"unique_layers"`
+	TotalSize    int64         `json:"total_size"`
+	UniqueSize   int64         `json:"unique_size"`
+	Shared       []SharedLayer `json:"shared_layers"`
 }
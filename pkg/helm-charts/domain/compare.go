@@ -0,0 +1,56 @@
+package domain
+
+// CompareInput holds the two charts compared, typically two versions of the same chart
+type CompareInput struct {
+	Old HelmLinkInput `json:"old"`
+	New HelmLinkInput `json:"new"`
+}
+
+// ImageChange is how an image differs between the old and the new chart
+type ImageChange string
+
+const (
+	ImageChangeAdded     ImageChange = "added"
+	ImageChangeRemoved   ImageChange = "removed"
+	ImageChangeChanged   ImageChange = "changed"
+	ImageChangeUnchanged ImageChange = "unchanged"
+)
+
+// ImageDiff compares an image repository in the old and the new chart. Deltas are new minus old.
+// SharedLayers counts the layers of the new image that the old image already has and SharedSize
+// sums their size, so upgrading a node that has the old image pulls NewSize - SharedSize bytes.
+type ImageDiff struct {
+	Repository   string      `json:"repository"`
+	Change       ImageChange `json:"change"`
+	OldReference string      `json:"old_reference,omitempty"`
+	NewReference string      `json:"new_reference,omitempty"`
+	OldDigest    string      `json:"old_digest,omitempty"`
+	NewDigest    string      `json:"new_digest,omitempty"`
+	OldSize      int64       `json:"old_size"`
+	NewSize      int64       `json:"new_size"`
+	SizeDelta    int64       `json:"size_delta"`
+	OldLayers    int         `json:"old_layers"`
+	NewLayers    int         `json:"new_layers"`
+	LayersDelta  int         `json:"layers_delta"`
+	SharedLayers int         `json:"shared_layers"`
+	SharedSize   int64       `json:"shared_size"`
+}
+
+// CompareSummary counts the image changes between two charts and their total image sizes
+type CompareSummary struct {
+	Added     int   `json:"added"`
+	Removed   int   `json:"removed"`
+	Changed   int   `json:"changed"`
+	Unchanged int   `json:"unchanged"`
+	OldSize   int64 `json:"old_size"`
+	NewSize   int64 `json:"new_size"`
+	SizeDelta int64 `json:"size_delta"`
+}
+
+// CompareResult lists how the images of two charts differ
+type CompareResult struct {
+	Old     *ChartDetails   `json:"old"`
+	New     *ChartDetails   `json:"new"`
+	Summary *CompareSummary `json:"summary"`
+	Images  []*ImageDiff    `json:"images"`
+}
@@ -1,5 +1,35 @@
 package domain
 
+// HelmLinkInput identifies the Helm chart to process. Either Path is set to an
+// HTTP(S) URL of a .tgz archive or an OCI reference such as
+// oci://registry/repo/chart:version, or RepoURL and Chart are set to resolve the
+// chart from the repository index, optionally constrained by a semver Version.
 type HelmLinkInput struct {
-	Path string `json:"url_link"`
+	Path    string `json:"url_link"`
+	RepoURL string `json:"repo_url"`
+	Chart   string `json:"chart"`
+	Version string `json:"version"`
+
+	RenderOptions
+	ImageOptions
+}
+
+// RenderOptions customises how a chart is rendered, mirroring the values flags of helm template.
+// Values is either a JSON object or a string holding a YAML document. Files from ValuesURLs are
+// applied in order, followed by Values and finally the Set overrides.
+type RenderOptions struct {
+	Values     interface{}       `json:"values,omitempty"`
+	ValuesURLs []string          `json:"values_urls,omitempty"`
+	Set        map[string]string `json:"set,omitempty"`
+}
+
+// ImageOptions customises how image metadata is looked up. Platform, in os/arch[/variant] form
+// such as linux/arm64, restricts multi-architecture images to the matching platforms. Inspect
+// reads the image config, and UncompressedSizes downloads every layer to measure its uncompressed size.
+// PinDigests suggests a values override pinning the images of the chart to their current digests.
+type ImageOptions struct {
+	Platform          string `json:"platform,omitempty"`
+	Inspect           bool   `json:"inspect,omitempty"`
+	UncompressedSizes bool   `json:"uncompressed_sizes,omitempty"`
+	PinDigests        bool   `json:"pin_digests,omitempty"`
 }
@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ScanStatus is the state of an asynchronous scan
+type ScanStatus string
+
+const (
+	ScanStatusQueued    ScanStatus = "queued"
+	ScanStatusRunning   ScanStatus = "running"
+	ScanStatusSucceeded ScanStatus = "succeeded"
+	ScanStatusFailed    ScanStatus = "failed"
+	ScanStatusCanceled  ScanStatus = "canceled"
+)
+
+// ScanProgress reports how far a scan has got. ImagesTotal is known once the chart is rendered.
+type ScanProgress struct {
+	Stage       ScanEventType `json:"stage,omitempty"`
+	ImagesTotal int           `json:"images_total"`
+	ImagesDone  int           `json:"images_done"`
+}
+
+// ScanJob is a chart scan running in the background
+type ScanJob struct {
+	ID         string           `json:"id"`
+	Status     ScanStatus       `json:"status"`
+	Progress   ScanProgress     `json:"progress"`
+	Error      string           `json:"error,omitempty"`
+	Result     *ChartScanResult `json:"result,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	StartedAt  *time.Time       `json:"started_at,omitempty"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+}
+
+// ScanEventType identifies a step of a scan
+type ScanEventType string
+
+const (
+	ScanEventChartDownloaded  ScanEventType = "chart_downloaded"
+	ScanEventChartRendered    ScanEventType = "chart_rendered"
+	ScanEventImagesDiscovered ScanEventType = "images_discovered"
+	ScanEventImageScanned     ScanEventType = "image_scanned"
+
+	// ScanEventCompleted and ScanEventFailed end a streamed scan
+	ScanEventCompleted ScanEventType = "completed"
+	ScanEventFailed    ScanEventType = "failed"
+)
+
+// ScanEvent is emitted as a scan progresses. Chart is set once the chart is downloaded, Images
+// counts the unique images discovered in the chart and Image is the outcome of one image lookup.
+// A streamed scan ends with the Result of the scan, or the Error it failed with.
+type ScanEvent struct {
+	Type   ScanEventType    `json:"type"`
+	Chart  *ChartDetails    `json:"chart,omitempty"`
+	Images int              `json:"images,omitempty"`
+	Image  *ImageDetails    `json:"image,omitempty"`
+	Result *ChartScanResult `json:"result,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+// scanEventsKey is the context key of the scan event listener
+type scanEventsKey struct{}
+
+// WithScanEvents returns a context whose scans report their progress to listener.
+// Image lookups run concurrently, so listener must be safe for concurrent use.
+func WithScanEvents(ctx context.Context, listener func(*ScanEvent)) context.Context {
+	return context.WithValue(ctx, scanEventsKey{}, listener)
+}
+
+// EmitScanEvent reports a scan event to the listener of the context, if any.
+func EmitScanEvent(ctx context.Context, event *ScanEvent) {
+	if listener, ok := ctx.Value(scanEventsKey{}).(func(*ScanEvent)); ok {
+		listener(event)
+	}
+}
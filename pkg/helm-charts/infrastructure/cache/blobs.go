@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// blobFormat marks a blob entry. JSON entries written by Put start with '{', so the two never collide.
+	blobFormat byte = 1
+
+	// blobHeaderSize is the size of the header in front of blob data: the format byte, followed by
+	// when the blob was stored and when it expires as big endian Unix nanoseconds, zero for never.
+	blobHeaderSize = 17
+)
+
+// blobHeader holds the times recorded in front of blob data
+type blobHeader struct {
+	StoredAt  int64
+	ExpiresAt int64
+}
+
+// expired reports whether the blob is past its expiry. Blobs without an expiry never expire.
+func (h blobHeader) expired(now time.Time) bool {
+	return h.ExpiresAt != 0 && now.UnixNano() > h.ExpiresAt
+}
+
+// decodeBlob splits a stored blob into its header and data, reporting false for values that are not blobs.
+func decodeBlob(stored []byte) (blobHeader, []byte, bool) {
+	var header blobHeader
+
+	if len(stored) < blobHeaderSize || stored[0] != blobFormat {
+		return header, nil, false
+	}
+
+	if _, err := binary.Decode(stored[1:blobHeaderSize], binary.BigEndian, &header); err != nil {
+		return header, nil, false
+	}
+
+	return header, stored[blobHeaderSize:], true
+}
+
+// PutBlob stores data under key as is, without encoding it, so large values such as chart archives
+// are stored at their own size. Blobs are never kept in memory. A ttl of zero keeps the blob until
+// it is purged or pruned.
+func (c *Cache) PutBlob(bucket, key string, data []byte, ttl time.Duration) error {
+	now := time.Now()
+
+	var expiresAt int64
+
+	if ttl > 0 {
+		expiresAt = now.Add(ttl).UnixNano()
+	}
+
+	stored := make([]byte, blobHeaderSize+len(data))
+	stored[0] = blobFormat
+	copy(stored[blobHeaderSize:], data)
+
+	header := blobHeader{StoredAt: now.UnixNano(), ExpiresAt: expiresAt}
+
+	if _, err := binary.Encode(stored[1:blobHeaderSize], binary.BigEndian, header); err != nil {
+		return fmt.Errorf("failed to encode %s entry %s: %w", bucket, key, err)
+	}
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(key), stored)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store %s entry %s: %w", bucket, key, err)
+	}
+
+	c.memory.Remove(memoryKey(bucket, key))
+
+	return nil
+}
+
+// GetBlob returns the data stored under key by PutBlob and reports whether a live blob was found.
+func (c *Cache) GetBlob(bucket, key string) ([]byte, bool, error) {
+	var (
+		data   []byte
+		header blobHeader
+		found  bool
+	)
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		stored := b.Get([]byte(key))
+		if stored == nil {
+			return nil
+		}
+
+		var blob []byte
+
+		header, blob, found = decodeBlob(stored)
+		if !found {
+			return fmt.Errorf("not a blob")
+		}
+
+		// stored is only valid during the transaction
+		data = append([]byte(nil), blob...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read cached %s entry %s: %w", bucket, key, err)
+	}
+
+	if !found {
+		return nil, false, nil
+	}
+
+	if header.expired(time.Now()) {
+		return nil, false, c.Delete(bucket, key)
+	}
+
+	return data, true, nil
+}
+
+// storedBlob locates a blob considered for pruning
+type storedBlob struct {
+	bucket   string
+	key      string
+	storedAt int64
+	size     int64
+}
+
+// PruneBlobs removes the expired blobs of the given buckets, and values that are not blobs, then
+// the oldest blobs until the buckets hold at most maxSize bytes together, and returns how many
+// entries were removed. A maxSize of zero only removes expired blobs. Space freed in the database
+// file is reused for new entries, although the file itself does not shrink.
+func (c *Cache) PruneBlobs(maxSize int64, buckets ...string) (int, error) {
+	now := time.Now()
+	removed := 0
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		var (
+			live  []storedBlob
+			total int64
+		)
+
+		for _, bucket := range buckets {
+			b := tx.Bucket([]byte(bucket))
+			if b == nil {
+				continue
+			}
+
+			var stale [][]byte
+
+			err := b.ForEach(func(k, v []byte) error {
+				header, _, ok := decodeBlob(v)
+				if !ok || header.expired(now) {
+					stale = append(stale, append([]byte(nil), k...))
+
+					return nil
+				}
+
+				size := int64(len(k) + len(v))
+				total += size
+
+				live = append(live, storedBlob{bucket: bucket, key: string(k), storedAt: header.StoredAt, size: size})
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, key := range stale {
+				if err := b.Delete(key); err != nil {
+					return err
+				}
+			}
+
+			removed += len(stale)
+		}
+
+		if maxSize <= 0 || total <= maxSize {
+			return nil
+		}
+
+		sort.Slice(live, func(i, j int) bool { return live[i].storedAt < live[j].storedAt })
+
+		for _, blob := range live {
+			if total <= maxSize {
+				break
+			}
+
+			if err := tx.Bucket([]byte(blob.bucket)).Delete([]byte(blob.key)); err != nil {
+				return err
+			}
+
+			total -= blob.size
+			removed++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune cached entries: %w", err)
+	}
+
+	return removed, nil
+}
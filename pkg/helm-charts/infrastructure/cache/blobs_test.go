@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache_GetPutBlob(t *testing.T) {
+	c := openTestCache(t, filepath.Join(t.TempDir(), "cache.db"), 16)
+
+	tests := []struct {
+		name   string
+		key    string
+		data   []byte
+		ttl    time.Duration
+		wait   time.Duration
+		wantOK bool
+	}{
+		{
+			name:   "success: blob without expiry",
+			key:    "sha256:aaaa",
+			data:   []byte{0x1f, 0x8b, 0x08, 0x00},
+			wantOK: true,
+		},
+		{
+			name:   "success: blob within its ttl",
+			key:    "sha256:bbbb",
+			data:   bytes.Repeat([]byte{0xff}, maxMemoryValueSize),
+			ttl:    time.Minute,
+			wantOK: true,
+		},
+		{
+			name:   "success: empty blob",
+			key:    "sha256:cccc",
+			data:   []byte{},
+			wantOK: true,
+		},
+		{
+			name:   "fail: expired blob",
+			key:    "sha256:dddd",
+			data:   []byte("expired"),
+			ttl:    time.Millisecond,
+			wait:   5 * time.Millisecond,
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.PutBlob("charts", tt.key, tt.data, tt.ttl); err != nil {
+				t.Fatalf("Cache.PutBlob() error = %v", err)
+			}
+
+			time.Sleep(tt.wait)
+
+			got, ok, err := c.GetBlob("charts", tt.key)
+			if err != nil {
+				t.Errorf("Cache.GetBlob() error = %v", err)
+				return
+			}
+
+			if ok != tt.wantOK {
+				t.Errorf("Cache.GetBlob() ok = %v, want %v", ok, tt.wantOK)
+				return
+			}
+
+			if ok && !bytes.Equal(got, tt.data) {
+				t.Errorf("Cache.GetBlob() = %d bytes, want %d bytes", len(got), len(tt.data))
+			}
+		})
+	}
+
+	if c.memory.Len() != 0 {
+		t.Errorf("Cache.PutBlob() kept %d blobs in memory", c.memory.Len())
+	}
+
+	if err := c.Put("charts", "json", &testValue{Name: "nginx"}, 0); err != nil {
+		t.Fatalf("Cache.Put() error = %v", err)
+	}
+
+	if _, ok, err := c.GetBlob("charts", "json"); ok || err == nil {
+		t.Errorf("Cache.GetBlob() of a JSON entry = %v, %v, want an error", ok, err)
+	}
+}
+
+func TestCache_PruneBlobs(t *testing.T) {
+	data := bytes.Repeat([]byte{0xff}, 1000)
+
+	tests := []struct {
+		name        string
+		maxSize     int64
+		wantRemoved int
+		wantLeft    map[string][]string
+	}{
+		{
+			name:        "success: expired blobs and other values",
+			wantRemoved: 2,
+			wantLeft:    map[string][]string{"archives": {"first", "second"}, "renders": {"third"}},
+		},
+		{
+			name:        "success: oldest blobs beyond the size",
+			maxSize:     2100,
+			wantRemoved: 3,
+			wantLeft:    map[string][]string{"archives": {"second"}, "renders": {"third"}},
+		},
+		{
+			name:        "success: within the size",
+			maxSize:     1 << 20,
+			wantRemoved: 2,
+			wantLeft:    map[string][]string{"archives": {"first", "second"}, "renders": {"third"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := openTestCache(t, filepath.Join(t.TempDir(), "cache.db"), 16)
+
+			blobs := []struct {
+				bucket string
+				key    string
+				ttl    time.Duration
+			}{
+				{bucket: "archives", key: "first"},
+				{bucket: "archives", key: "expired", ttl: time.Millisecond},
+				{bucket: "archives", key: "second", ttl: time.Hour},
+				{bucket: "renders", key: "third"},
+			}
+
+			for _, blob := range blobs {
+				if err := c.PutBlob(blob.bucket, blob.key, data, blob.ttl); err != nil {
+					t.Fatalf("Cache.PutBlob() error = %v", err)
+				}
+
+				time.Sleep(2 * time.Millisecond)
+			}
+
+			if err := c.Put("renders", "json", &testValue{Name: "nginx"}, 0); err != nil {
+				t.Fatalf("Cache.Put() error = %v", err)
+			}
+
+			if err := c.PutBlob("images", "untouched", data, time.Millisecond); err != nil {
+				t.Fatalf("Cache.PutBlob() error = %v", err)
+			}
+
+			removed, err := c.PruneBlobs(tt.maxSize, "archives", "renders")
+			if err != nil {
+				t.Fatalf("Cache.PruneBlobs() error = %v", err)
+			}
+
+			if removed != tt.wantRemoved {
+				t.Errorf("Cache.PruneBlobs() = %v, want %v", removed, tt.wantRemoved)
+			}
+
+			for bucket, keys := range tt.wantLeft {
+				for _, key := range keys {
+					if _, ok, err := c.GetBlob(bucket, key); !ok || err != nil {
+						t.Errorf("Cache.PruneBlobs() removed %s from %s: %v", key, bucket, err)
+					}
+				}
+
+				left, err := c.DeletePrefix(bucket, "")
+				if err != nil {
+					t.Fatalf("Cache.DeletePrefix() error = %v", err)
+				}
+
+				if left != len(keys) {
+					t.Errorf("Cache.PruneBlobs() left %d entries in %s, want %v", left, bucket, keys)
+				}
+			}
+
+			if left, _ := c.DeletePrefix("images", ""); left != 1 {
+				t.Errorf("Cache.PruneBlobs() pruned a bucket it was not given")
+			}
+		})
+	}
+}
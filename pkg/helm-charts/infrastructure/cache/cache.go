@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// openTimeout bounds how long Open waits for another process holding the database lock
+	openTimeout = 5 * time.Second
+
+	// maxMemoryValueSize is the largest encoded value kept in memory. Larger values, such as chart
+	// archives, are always read from the database so they cannot exhaust memory.
+	maxMemoryValueSize = 64 << 10
+)
+
+// entry is a cached value together with its expiry
+type entry struct {
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt time.Time       `json:"expires_at,omitempty"`
+}
+
+// expired reports whether the entry is past its expiry. Entries without an expiry never expire.
+func (e *entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// Cache is a persistent key-value store with an in-memory LRU of small entries in front of it.
+// Keys are grouped in buckets, and values are JSON documents with an optional time to live.
+type Cache struct {
+	db     *bolt.DB
+	memory *lru.Cache[string, *entry]
+}
+
+// Open opens, or creates, the cache database at path, keeping up to memoryEntries
+// entries in memory.
+func Open(path string, memoryEntries int) (*Cache, error) {
+	memory, err := lru.New[string, *entry](memoryEntries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create in-memory cache: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache database: %w", err)
+	}
+
+	return &Cache{
+		db:     db,
+		memory: memory,
+	}, nil
+}
+
+// Close closes the cache database.
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+// memoryKey identifies a bucket entry in the in-memory cache
+func memoryKey(bucket, key string) string {
+	return bucket + "\x00" + key
+}
+
+// Get decodes the value stored under key into value and reports whether a live entry was found.
+func (c *Cache) Get(bucket, key string, value interface{}) (bool, error) {
+	cached, ok := c.memory.Get(memoryKey(bucket, key))
+	if !ok {
+		var err error
+
+		cached, err = c.load(bucket, key)
+		if err != nil || cached == nil {
+			return false, err
+		}
+
+		c.remember(bucket, key, cached)
+	}
+
+	if cached.expired(time.Now()) {
+		return false, c.Delete(bucket, key)
+	}
+
+	if err := json.Unmarshal(cached.Value, value); err != nil {
+		return false, fmt.Errorf("failed to decode cached %s entry %s: %w", bucket, key, err)
+	}
+
+	return true, nil
+}
+
+// load reads an entry from the database, returning nil when it is not stored.
+func (c *Cache) load(bucket, key string) (*entry, error) {
+	var cached *entry
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+
+		cached = &entry{}
+
+		return json.Unmarshal(data, cached)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached %s entry %s: %w", bucket, key, err)
+	}
+
+	return cached, nil
+}
+
+// Put stores value under key. A ttl of zero keeps the entry until it is purged.
+func (c *Cache) Put(bucket, key string, value interface{}, ttl time.Duration) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s entry %s: %w", bucket, key, err)
+	}
+
+	cached := &entry{Value: encoded}
+
+	if ttl > 0 {
+		cached.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s entry %s: %w", bucket, key, err)
+	}
+
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(key), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store %s entry %s: %w", bucket, key, err)
+	}
+
+	c.remember(bucket, key, cached)
+
+	return nil
+}
+
+// remember keeps small entries in memory.
+func (c *Cache) remember(bucket, key string, cached *entry) {
+	if len(cached.Value) > maxMemoryValueSize {
+		c.memory.Remove(memoryKey(bucket, key))
+		return
+	}
+
+	c.memory.Add(memoryKey(bucket, key), cached)
+}
+
+// Delete removes the entry stored under key.
+func (c *Cache) Delete(bucket, key string) error {
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s entry %s: %w", bucket, key, err)
+	}
+
+	c.memory.Remove(memoryKey(bucket, key))
+
+	return nil
+}
+
+// DeletePrefix removes the entries of a bucket whose key starts with prefix and returns how many
+// were removed. An empty prefix empties the bucket.
+func (c *Cache) DeletePrefix(bucket, prefix string) (int, error) {
+	var deleted []string
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		cursor := b.Cursor()
+
+		for k, _ := cursor.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, _ = cursor.Next() {
+			deleted = append(deleted, string(k))
+		}
+
+		for _, key := range deleted {
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge %s entries: %w", bucket, err)
+	}
+
+	for _, key := range deleted {
+		c.memory.Remove(memoryKey(bucket, key))
+	}
+
+	return len(deleted), nil
+}
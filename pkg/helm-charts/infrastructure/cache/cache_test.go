@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testValue is a cached document
+type testValue struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// openTestCache opens a cache in a temporary directory that is closed when the test ends
+func openTestCache(t *testing.T, path string, memoryEntries int) *Cache {
+	t.Helper()
+
+	c, err := Open(path, memoryEntries)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestCache_GetPut(t *testing.T) {
+	c := openTestCache(t, filepath.Join(t.TempDir(), "cache.db"), 1)
+
+	tests := []struct {
+		name   string
+		key    string
+		value  *testValue
+		ttl    time.Duration
+		wait   time.Duration
+		wantOK bool
+	}{
+		{
+			name:   "success: entry without expiry",
+			key:    "sha256:aaaa",
+			value:  &testValue{Name: "nginx", Size: 42},
+			wantOK: true,
+		},
+		{
+			name:   "success: entry within its ttl",
+			key:    "sha256:bbbb",
+			value:  &testValue{Name: "redis", Size: 7},
+			ttl:    time.Minute,
+			wantOK: true,
+		},
+		{
+			name:   "fail: expired entry",
+			key:    "sha256:cccc",
+			value:  &testValue{Name: "postgres", Size: 1},
+			ttl:    time.Millisecond,
+			wait:   5 * time.Millisecond,
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.Put("images", tt.key, tt.value, tt.ttl); err != nil {
+				t.Fatalf("Cache.Put() error = %v", err)
+			}
+
+			time.Sleep(tt.wait)
+
+			got := &testValue{}
+
+			ok, err := c.Get("images", tt.key, got)
+			if err != nil {
+				t.Errorf("Cache.Get() error = %v", err)
+				return
+			}
+
+			if ok != tt.wantOK {
+				t.Errorf("Cache.Get() ok = %v, want %v", ok, tt.wantOK)
+				return
+			}
+
+			if ok && *got != *tt.value {
+				t.Errorf("Cache.Get() = %+v, want %+v", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestCache_persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	c, err := Open(path, 16)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	if err := c.Put("images", "sha256:aaaa", &testValue{Name: "nginx", Size: 42}, 0); err != nil {
+		t.Fatalf("Cache.Put() error = %v", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Cache.Close() error = %v", err)
+	}
+
+	reopened := openTestCache(t, path, 16)
+
+	got := &testValue{}
+
+	ok, err := reopened.Get("images", "sha256:aaaa", got)
+	if err != nil || !ok || got.Name != "nginx" {
+		t.Errorf("Cache.Get() = %+v, %v, %v after reopening", got, ok, err)
+	}
+}
+
+func TestCache_DeletePrefix(t *testing.T) {
+	c := openTestCache(t, filepath.Join(t.TempDir(), "cache.db"), 16)
+
+	for _, key := range []string{"sha256:aaaa|", "sha256:aaaa|linux/arm64", "sha256:bbbb|"} {
+		if err := c.Put("images", key, &testValue{Name: key}, 0); err != nil {
+			t.Fatalf("Cache.Put() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		prefix      string
+		wantDeleted int
+		wantLeft    []string
+	}{
+		{
+			name:        "success: entries of one digest",
+			prefix:      "sha256:aaaa|",
+			wantDeleted: 2,
+			wantLeft:    []string{"sha256:bbbb|"},
+		},
+		{
+			name:        "success: nothing matches",
+			prefix:      "sha256:cccc|",
+			wantDeleted: 0,
+			wantLeft:    []string{"sha256:bbbb|"},
+		},
+		{
+			name:        "success: whole bucket",
+			prefix:      "",
+			wantDeleted: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deleted, err := c.DeletePrefix("images", tt.prefix)
+			if err != nil {
+				t.Errorf("Cache.DeletePrefix() error = %v", err)
+				return
+			}
+
+			if deleted != tt.wantDeleted {
+				t.Errorf("Cache.DeletePrefix() = %v, want %v", deleted, tt.wantDeleted)
+			}
+
+			for _, key := range tt.wantLeft {
+				if ok, _ := c.Get("images", key, &testValue{}); !ok {
+					t.Errorf("Cache.DeletePrefix() removed %s", key)
+				}
+			}
+		})
+	}
+
+	if ok, _ := c.Get("images", "sha256:aaaa|linux/arm64", &testValue{}); ok {
+		t.Errorf("Cache.Get() returned a purged entry")
+	}
+}
+
+func TestCache_largeValues(t *testing.T) {
+	c := openTestCache(t, filepath.Join(t.TempDir(), "cache.db"), 16)
+
+	archive := make([]byte, maxMemoryValueSize)
+
+	if err := c.Put("charts", "sha256:aaaa", archive, 0); err != nil {
+		t.Fatalf("Cache.Put() error = %v", err)
+	}
+
+	if c.memory.Contains(memoryKey("charts", "sha256:aaaa")) {
+		t.Errorf("Cache.Put() kept a large value in memory")
+	}
+
+	var got []byte
+
+	ok, err := c.Get("charts", "sha256:aaaa", &got)
+	if err != nil || !ok || len(got) != len(archive) {
+		t.Errorf("Cache.Get() = %d bytes, %v, %v, want %d bytes", len(got), ok, err, len(archive))
+	}
+
+	if c.memory.Contains(memoryKey("charts", "sha256:aaaa")) {
+		t.Errorf("Cache.Get() kept a large value in memory")
+	}
+}
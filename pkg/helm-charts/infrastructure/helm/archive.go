@@ -0,0 +1,75 @@
+package helm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// chartMetadata holds the fields of Chart.yaml that identify a chart
+type chartMetadata struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+}
+
+// isChartFile reports whether a tar entry is the Chart.yaml at the root of a packaged chart.
+func isChartFile(entryName string) bool {
+	dir, file := path.Split(path.Clean(entryName))
+
+	return file == "Chart.yaml" && dir != "" && strings.Count(dir, "/") == 1
+}
+
+// inspectChartArchive checks that the file at chartPath is a packaged Helm chart and
+// returns the metadata from its Chart.yaml.
+func inspectChartArchive(chartPath string) (*chartMetadata, error) {
+	file, err := os.Open(chartPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chart archive: %w", err)
+	}
+
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid chart archive: Chart.yaml not found")
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid chart archive: %w", err)
+		}
+
+		if header.Typeflag != tar.TypeReg || !isChartFile(header.Name) {
+			continue
+		}
+
+		metadata := &chartMetadata{}
+
+		err = yaml.NewDecoder(tarReader).Decode(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Chart.yaml: %w", err)
+		}
+
+		if metadata.Name == "" {
+			return nil, fmt.Errorf("invalid Chart.yaml: chart name is missing")
+		}
+
+		return metadata, nil
+	}
+}
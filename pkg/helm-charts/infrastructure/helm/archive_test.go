@@ -0,0 +1,182 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testChartYAML = `apiVersion: v2
+name: hello-world
+version: 0.1.0
+`
+
+// buildChartArchive packages files, keyed by their path in the archive, into a gzipped tarball
+func buildChartArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for name, content := range files {
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write tar entry: %v", err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// writeChartArchive stores content in a temporary file and returns its path
+func writeChartArchive(t *testing.T, content []byte) string {
+	t.Helper()
+
+	chartPath := filepath.Join(t.TempDir(), "chart.tgz")
+
+	if err := os.WriteFile(chartPath, content, 0o600); err != nil {
+		t.Fatalf("failed to write chart archive: %v", err)
+	}
+
+	return chartPath
+}
+
+func TestInspectChartArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    *chartMetadata
+		wantErr bool
+	}{
+		{
+			name: "success: valid chart",
+			content: buildChartArchive(t, map[string]string{
+				"hello-world/Chart.yaml":             testChartYAML,
+				"hello-world/templates/service.yaml": "kind: Service",
+			}),
+			want: &chartMetadata{
+				Name:    "hello-world",
+				Version: "0.1.0",
+			},
+			wantErr: false,
+		},
+		{
+			name: "fail: Chart.yaml missing",
+			content: buildChartArchive(t, map[string]string{
+				"hello-world/values.yaml": "replicaCount: 1",
+			}),
+			wantErr: true,
+		},
+		{
+			name: "fail: Chart.yaml only in a subchart",
+			content: buildChartArchive(t, map[string]string{
+				"hello-world/charts/redis/Chart.yaml": testChartYAML,
+			}),
+			wantErr: true,
+		},
+		{
+			name: "fail: Chart.yaml outside a chart directory",
+			content: buildChartArchive(t, map[string]string{
+				"Chart.yaml": testChartYAML,
+			}),
+			wantErr: true,
+		},
+		{
+			name: "fail: Chart.yaml without a name",
+			content: buildChartArchive(t, map[string]string{
+				"hello-world/Chart.yaml": "apiVersion: v2\nversion: 0.1.0\n",
+			}),
+			wantErr: true,
+		},
+		{
+			name:    "fail: not a gzip archive",
+			content: []byte("fake tarball content"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inspectChartArchive(writeChartArchive(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("inspectChartArchive() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && *got != *tt.want {
+				t.Errorf("inspectChartArchive() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_ProcessHelmChartArchive(t *testing.T) {
+	type args struct {
+		ctx     context.Context
+		archive io.Reader
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "success: process uploaded chart",
+			args: args{
+				ctx: context.Background(),
+				archive: bytes.NewReader(buildChartArchive(t, map[string]string{
+					"hello-world/Chart.yaml": testChartYAML,
+				})),
+			},
+			wantErr: false,
+		},
+		{
+			name: "fail: uploaded file is not a chart",
+			args: args{
+				ctx:     context.Background(),
+				archive: bytes.NewReader([]byte("fake tarball content")),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger)
+
+			_, err := s.ProcessHelmChartArchive(tt.args.ctx, tt.args.archive)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Service.ProcessHelmChartArchive() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+		})
+	}
+}
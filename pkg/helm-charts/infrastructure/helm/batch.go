@@ -0,0 +1,146 @@
+package helm
+
+import (
+	"context"
+	"sync"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+// sharedLookupsKey is the context key of the image lookups shared by the charts of a batch
+type sharedLookupsKey struct{}
+
+// sharedLookup is an image lookup that is in flight, or done once done is closed
+type sharedLookup struct {
+	done    chan struct{}
+	details *domain.ImageDetails
+}
+
+// sharedLookups deduplicates the image lookups of the charts of a batch, so an image referenced
+// by several charts is only fetched once.
+type sharedLookups struct {
+	mu      sync.Mutex
+	lookups map[string]*sharedLookup
+}
+
+// sharedLookupsFrom returns the shared lookups of the batch ctx belongs to, or nil outside a batch
+func sharedLookupsFrom(ctx context.Context) *sharedLookups {
+	lookups, _ := ctx.Value(sharedLookupsKey{}).(*sharedLookups)
+
+	return lookups
+}
+
+// lookup returns a copy of the details of the image, fetching them unless another chart of the
+// batch already has. Lookups that timed out or were canceled are not shared: charts waiting on
+// one look the image up again with their own context, and later charts start a new lookup.
+func (l *sharedLookups) lookup(
+	ctx context.Context,
+	usage *imageUsage,
+	opts *lookupOptions,
+	fetch func(context.Context, *imageUsage, *lookupOptions) *domain.ImageDetails,
+) *domain.ImageDetails {
+	if l == nil {
+		return fetch(ctx, usage, opts)
+	}
+
+	key := usage.reference + "|" + opts.key()
+
+	for {
+		l.mu.Lock()
+
+		lookup, ok := l.lookups[key]
+		if !ok {
+			lookup = &sharedLookup{done: make(chan struct{})}
+			l.lookups[key] = lookup
+		}
+
+		l.mu.Unlock()
+
+		if !ok {
+			lookup.details = fetch(ctx, usage, opts)
+
+			if abandonedLookup(lookup.details) {
+				l.mu.Lock()
+				delete(l.lookups, key)
+				l.mu.Unlock()
+			}
+
+			close(lookup.done)
+		} else {
+			select {
+			case <-lookup.done:
+			case <-ctx.Done():
+				return &domain.ImageDetails{Status: classifyImageError(ctx.Err()), Error: ctx.Err().Error()}
+			}
+
+			if abandonedLookup(lookup.details) {
+				continue
+			}
+		}
+
+		details := *lookup.details
+
+		return &details
+	}
+}
+
+// abandonedLookup reports whether a lookup ended because the context of the chart running it was done.
+func abandonedLookup(details *domain.ImageDetails) bool {
+	return details.Status == domain.ImageStatusTimeout || details.Status == domain.ImageStatusCanceled
+}
+
+// ProcessHelmChartBatch processes several charts, at most batchConcurrency at a time, looking up
+// images shared by several charts once. Results are returned in input order; charts that could
+// not be processed, or were not started before ctx was done, report their error.
+func (s *Service) ProcessHelmChartBatch(ctx context.Context, inputs []*domain.HelmLinkInput) []*domain.BatchChartResult {
+	ctx = context.WithValue(ctx, sharedLookupsKey{}, &sharedLookups{lookups: map[string]*sharedLookup{}})
+
+	results := make([]*domain.BatchChartResult, len(inputs))
+
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range min(s.batchConcurrency, len(inputs)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				results[i] = &domain.BatchChartResult{Index: i}
+
+				result, err := s.ProcessHelmChart(ctx, inputs[i])
+				if err != nil {
+					s.logger.Printf("Failed to process chart %d of batch: %v", i, err)
+
+					results[i].Error = err.Error()
+
+					continue
+				}
+
+				results[i].Result = result
+			}
+		}()
+	}
+
+dispatch:
+	for i := range inputs {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	for i := range inputs {
+		if results[i] == nil {
+			results[i] = &domain.BatchChartResult{Index: i, Error: ctx.Err().Error()}
+		}
+	}
+
+	return results
+}
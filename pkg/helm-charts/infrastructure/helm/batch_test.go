@@ -0,0 +1,174 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+func TestService_lookupImages_sharedLookups(t *testing.T) {
+	host, requests := newCountingRegistry(t)
+
+	shared := fmt.Sprintf("%s/library/nginx:1.25", host)
+	only := fmt.Sprintf("%s/library/redis:7", host)
+
+	pushRandomImage(t, shared, 2)
+	pushRandomImage(t, only, 1)
+
+	logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+	s := NewHelmService(logger, withLoopback())
+
+	// Two charts of a batch reference the shared image
+	charts := [][]*imageUsage{
+		groupImages([]imageReference{
+			{image: shared, source: domain.ImageSource{Template: "a/templates/deployment.yaml"}},
+			{image: only, source: domain.ImageSource{Template: "a/templates/statefulset.yaml"}},
+		}),
+		groupImages([]imageReference{
+			{image: shared, source: domain.ImageSource{Template: "b/templates/deployment.yaml"}},
+			{image: shared, source: domain.ImageSource{Template: "b/templates/job.yaml"}},
+		}),
+	}
+
+	ctx := context.WithValue(context.Background(), sharedLookupsKey{}, &sharedLookups{lookups: map[string]*sharedLookup{}})
+
+	results := make([][]*domain.ImageDetails, len(charts))
+
+	requests.Store(0)
+
+	var wg sync.WaitGroup
+
+	for i, usages := range charts {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[i], _ = s.lookupImages(ctx, usages, &lookupOptions{})
+		}()
+	}
+
+	wg.Wait()
+
+	if got := requests.Load(); got != 2 {
+		t.Errorf("Service.lookupImages() made %d manifest requests, want 2", got)
+	}
+
+	a, b := results[0][0], results[1][0]
+
+	if a.Status != domain.ImageStatusOK || a.Digest == "" || a.Digest != b.Digest || a.Size != b.Size {
+		t.Errorf("Service.lookupImages() shared image = %+v and %+v, want the same details", a, b)
+	}
+
+	if a.Occurrences != 1 || b.Occurrences != 2 || a.Sources[0].Template != "a/templates/deployment.yaml" {
+		t.Errorf("Service.lookupImages() shared image occurrences = %d and %d, want the usages of each chart", a.Occurrences, b.Occurrences)
+	}
+}
+
+func TestSharedLookups_lookup(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      domain.ImageStatus
+		wantFetches int
+	}{
+		{
+			name:        "success: successful lookups are shared",
+			status:      domain.ImageStatusOK,
+			wantFetches: 1,
+		},
+		{
+			name:        "success: failed lookups are shared",
+			status:      domain.ImageStatusNotFound,
+			wantFetches: 1,
+		},
+		{
+			name:        "success: timed out lookups are retried",
+			status:      domain.ImageStatusTimeout,
+			wantFetches: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookups := &sharedLookups{lookups: map[string]*sharedLookup{}}
+
+			fetches := 0
+
+			fetch := func(_ context.Context, _ *imageUsage, _ *lookupOptions) *domain.ImageDetails {
+				fetches++
+
+				return &domain.ImageDetails{Status: tt.status}
+			}
+
+			usage := &imageUsage{image: "nginx:1.25", reference: "index.docker.io/library/nginx:1.25"}
+
+			first := lookups.lookup(context.Background(), usage, &lookupOptions{}, fetch)
+			first.Occurrences = 3
+
+			second := lookups.lookup(context.Background(), usage, &lookupOptions{}, fetch)
+
+			if fetches != tt.wantFetches {
+				t.Errorf("sharedLookups.lookup() fetched %d times, want %d", fetches, tt.wantFetches)
+			}
+
+			if second.Occurrences != 0 || second.Status != tt.status {
+				t.Errorf("sharedLookups.lookup() = %+v, want an unmodified copy", second)
+			}
+		})
+	}
+}
+
+func TestSharedLookups_lookup_abandoned(t *testing.T) {
+	lookups := &sharedLookups{lookups: map[string]*sharedLookup{}}
+
+	var fetches atomic.Int64
+
+	started := make(chan struct{})
+
+	fetch := func(ctx context.Context, _ *imageUsage, _ *lookupOptions) *domain.ImageDetails {
+		if fetches.Add(1) == 1 {
+			close(started)
+
+			<-ctx.Done()
+
+			return &domain.ImageDetails{Status: classifyImageError(ctx.Err()), Error: ctx.Err().Error()}
+		}
+
+		return &domain.ImageDetails{Status: domain.ImageStatusOK}
+	}
+
+	usage := &imageUsage{image: "nginx:1.25", reference: "index.docker.io/library/nginx:1.25"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	first := make(chan *domain.ImageDetails)
+
+	go func() {
+		first <- lookups.lookup(ctx, usage, &lookupOptions{}, fetch)
+	}()
+
+	<-started
+
+	// waits on the lookup of the first chart until its deadline passes
+	second := lookups.lookup(context.Background(), usage, &lookupOptions{}, fetch)
+
+	if got := <-first; got.Status != domain.ImageStatusTimeout {
+		t.Errorf("sharedLookups.lookup() of the chart that timed out = %+v, want %v", got, domain.ImageStatusTimeout)
+	}
+
+	if second.Status != domain.ImageStatusOK {
+		t.Errorf("sharedLookups.lookup() of the waiting chart = %+v, want %v", second, domain.ImageStatusOK)
+	}
+
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("sharedLookups.lookup() fetched %d times, want 2", got)
+	}
+}
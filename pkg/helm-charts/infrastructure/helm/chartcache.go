@@ -0,0 +1,234 @@
+package helm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/infrastructure/cache"
+)
+
+const (
+	// chartURLBucket holds the validators and digest of the archive last downloaded from a chart URL
+	chartURLBucket = "charts/urls"
+
+	// chartArchiveBucket holds chart archives keyed by their SHA-256 digest
+	chartArchiveBucket = "charts/archives"
+
+	// chartRenderBucket holds rendered templates keyed by archive digest and values digest
+	chartRenderBucket = "charts/renders/v2"
+
+	// DefaultChartCacheTTL is how long chart archives and rendered templates are cached
+	DefaultChartCacheTTL = 24 * time.Hour
+
+	// DefaultChartCacheMaxSize bounds the bytes the chart cache stores
+	DefaultChartCacheMaxSize = 1 << 30
+)
+
+// chartBuckets are the buckets of the chart cache, which are pruned and purged together
+var chartBuckets = []string{chartURLBucket, chartArchiveBucket, chartRenderBucket}
+
+// chartValidators are the HTTP validators of a downloaded chart archive
+type chartValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Digest       string `json:"digest"`
+}
+
+// apply adds conditional request headers revalidating the cached archive.
+func (v *chartValidators) apply(req *http.Request) {
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// WithChartCache caches downloaded chart archives, revalidating them with conditional requests,
+// and the manifests rendered from them for each set of values. Entries expire after ttl, and once
+// the chart cache holds more than maxSize bytes the oldest entries are evicted. Zero disables either bound.
+func WithChartCache(c *cache.Cache, ttl time.Duration, maxSize int64) Option {
+	return func(s *Service) {
+		s.chartCache = c
+		s.chartCacheTTL = ttl
+		s.chartCacheMaxSize = maxSize
+	}
+}
+
+// cachedValidators returns the validators of the archive cached for url, or nil when the
+// archive cannot be revalidated.
+func (s *Service) cachedValidators(url string) *chartValidators {
+	validators := &chartValidators{}
+
+	if !s.cachedChartEntry(chartURLBucket, url, validators) || (validators.ETag == "" && validators.LastModified == "") {
+		return nil
+	}
+
+	return validators
+}
+
+// cachedArchive returns the cached archive with the given digest.
+func (s *Service) cachedArchive(digest string) ([]byte, bool) {
+	archive, ok, err := s.chartCache.GetBlob(chartArchiveBucket, digest)
+	if err != nil {
+		s.logger.Printf("Failed to read cached chart archive %s: %v", digest, err)
+	}
+
+	return archive, ok
+}
+
+// cachedChartEntry decodes the JSON document cached under key into value and reports whether it was found.
+func (s *Service) cachedChartEntry(bucket, key string, value interface{}) bool {
+	data, ok, err := s.chartCache.GetBlob(bucket, key)
+	if err == nil && ok {
+		err = json.Unmarshal(data, value)
+	}
+
+	if err != nil {
+		s.logger.Printf("Failed to read cached %s entry %s: %v", bucket, key, err)
+
+		return false
+	}
+
+	return ok
+}
+
+// cacheChartEntry stores data in the chart cache, then prunes expired entries and the oldest
+// entries beyond the size bound. Failures are logged, they never fail a scan.
+func (s *Service) cacheChartEntry(bucket, key string, data []byte) {
+	if err := s.chartCache.PutBlob(bucket, key, data, s.chartCacheTTL); err != nil {
+		s.logger.Printf("Failed to cache %s entry %s: %v", bucket, key, err)
+
+		return
+	}
+
+	if _, err := s.chartCache.PruneBlobs(s.chartCacheMaxSize, chartBuckets...); err != nil {
+		s.logger.Printf("Failed to prune the chart cache: %v", err)
+	}
+}
+
+// cacheChartDocument stores value in the chart cache as a JSON document.
+func (s *Service) cacheChartDocument(bucket, key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		s.logger.Printf("Failed to encode %s entry %s: %v", bucket, key, err)
+
+		return
+	}
+
+	s.cacheChartEntry(bucket, key, data)
+}
+
+// PurgeChartCache removes every cached chart archive, repository URL validator and rendered template.
+func (s *Service) PurgeChartCache(_ context.Context) (*domain.CachePurgeResult, error) {
+	if s.chartCache == nil {
+		return nil, fmt.Errorf("chart cache is not enabled")
+	}
+
+	purged := 0
+
+	for _, bucket := range chartBuckets {
+		count, err := s.chartCache.DeletePrefix(bucket, "")
+		if err != nil {
+			return nil, err
+		}
+
+		purged += count
+	}
+
+	return &domain.CachePurgeResult{Purged: purged}, nil
+}
+
+// downloadCachedChart downloads a Helm chart, revalidating a previously downloaded archive of the
+// same URL instead of downloading it again when the server supports conditional requests.
+func (s *Service) downloadCachedChart(ctx context.Context, url string) (string, domain.CacheStatus, error) {
+	validators := s.cachedValidators(url)
+
+	var cached []byte
+
+	if validators != nil {
+		archive, ok := s.cachedArchive(validators.Digest)
+		if ok {
+			cached = archive
+		} else {
+			validators = nil
+		}
+	}
+
+	resp, err := s.conditionalGet(ctx, url, validators)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to download Helm chart: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		chartPath, err := s.saveHelmChart(bytes.NewReader(cached))
+
+		return chartPath, domain.CacheStatusHit, err
+	}
+
+	archive, err := readAllLimited(resp.Body, s.limits.MaxArchiveSize, errArchiveTooLarge)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to download Helm chart: %w", err)
+	}
+
+	sum := sha256.Sum256(archive)
+	digest := hex.EncodeToString(sum[:])
+
+	s.cacheChartEntry(chartArchiveBucket, digest, archive)
+
+	s.cacheChartDocument(chartURLBucket, url, &chartValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Digest:       digest,
+	})
+
+	chartPath, err := s.saveHelmChart(bytes.NewReader(archive))
+
+	return chartPath, domain.CacheStatusMiss, err
+}
+
+// renderCachedChart renders a chart, reusing the templates rendered from the same archive with the
+// same values when the chart cache is enabled. chart.Digest identifies the archive.
+func (s *Service) renderCachedChart(
+	ctx context.Context, chart *domain.ChartDetails, chartPath string, values *renderValues,
+) ([]renderedTemplate, error) {
+	if s.chartCache == nil {
+		return s.renderer.render(ctx, chartPath, values)
+	}
+
+	valuesDigest, err := values.digest()
+	if err != nil {
+		return nil, err
+	}
+
+	key := chart.Digest + "|" + valuesDigest
+
+	var rendered []renderedTemplate
+
+	if s.cachedChartEntry(chartRenderBucket, key, &rendered) {
+		chart.RenderCache = domain.CacheStatusHit
+
+		return rendered, nil
+	}
+
+	rendered, err = s.renderer.render(ctx, chartPath, values)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cacheChartDocument(chartRenderBucket, key, rendered)
+
+	chart.RenderCache = domain.CacheStatusMiss
+
+	return rendered, nil
+}
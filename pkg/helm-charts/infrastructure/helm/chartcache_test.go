@@ -0,0 +1,361 @@
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+const testChartURL = "https://charts.bitnami.com/bitnami/redis-20.6.1.tgz"
+
+func TestService_downloadCachedChart(t *testing.T) {
+	archive := buildChartArchive(t, map[string]string{"redis/Chart.yaml": testChartYAML})
+
+	tests := []struct {
+		name string
+		// headers returned with the archive
+		etag         string
+		lastModified string
+		wantStatuses []domain.CacheStatus
+		wantBodies   int
+	}{
+		{
+			name:         "success: revalidated with etag",
+			etag:         `"v1"`,
+			wantStatuses: []domain.CacheStatus{domain.CacheStatusMiss, domain.CacheStatusHit, domain.CacheStatusHit},
+			wantBodies:   1,
+		},
+		{
+			name:         "success: revalidated with last modified",
+			lastModified: "Wed, 01 Jan 2025 00:00:00 GMT",
+			wantStatuses: []domain.CacheStatus{domain.CacheStatusMiss, domain.CacheStatusHit},
+			wantBodies:   1,
+		},
+		{
+			name:         "success: downloaded again without validators",
+			wantStatuses: []domain.CacheStatus{domain.CacheStatusMiss, domain.CacheStatusMiss},
+			wantBodies:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, WithChartCache(openTestCache(t), DefaultChartCacheTTL, DefaultChartCacheMaxSize))
+
+			httpmock.ActivateNonDefault(s.httpClient)
+			defer httpmock.DeactivateAndReset()
+
+			bodies := 0
+
+			httpmock.RegisterResponder(http.MethodGet, testChartURL, func(req *http.Request) (*http.Response, error) {
+				if (tt.etag != "" && req.Header.Get("If-None-Match") == tt.etag) ||
+					(tt.lastModified != "" && req.Header.Get("If-Modified-Since") == tt.lastModified) {
+					return httpmock.NewStringResponse(http.StatusNotModified, ""), nil
+				}
+
+				bodies++
+
+				resp := httpmock.NewBytesResponse(http.StatusOK, archive)
+
+				if tt.etag != "" {
+					resp.Header.Set("ETag", tt.etag)
+				}
+
+				if tt.lastModified != "" {
+					resp.Header.Set("Last-Modified", tt.lastModified)
+				}
+
+				return resp, nil
+			})
+
+			for i, want := range tt.wantStatuses {
+				chartPath, status, err := s.downloadCachedChart(context.Background(), testChartURL)
+				if err != nil {
+					t.Fatalf("Service.downloadCachedChart() error = %v", err)
+				}
+
+				content, err := os.ReadFile(chartPath)
+				if err != nil || string(content) != string(archive) {
+					t.Errorf("Service.downloadCachedChart() request %d saved %d bytes, want %d", i, len(content), len(archive))
+				}
+
+				os.Remove(chartPath)
+
+				if status != want {
+					t.Errorf("Service.downloadCachedChart() request %d status = %v, want %v", i, status, want)
+				}
+			}
+
+			if bodies != tt.wantBodies {
+				t.Errorf("Service.downloadCachedChart() downloaded %d times, want %d", bodies, tt.wantBodies)
+			}
+		})
+	}
+}
+
+func TestService_downloadCachedChart_changed(t *testing.T) {
+	logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+	s := NewHelmService(logger, WithChartCache(openTestCache(t), DefaultChartCacheTTL, DefaultChartCacheMaxSize))
+
+	httpmock.ActivateNonDefault(s.httpClient)
+	defer httpmock.DeactivateAndReset()
+
+	versions := []string{"apiVersion: v2\nname: redis\nversion: 1.0.0\n", "apiVersion: v2\nname: redis\nversion: 2.0.0\n"}
+
+	for i, chartYAML := range versions {
+		archive := buildChartArchive(t, map[string]string{"redis/Chart.yaml": chartYAML})
+		etag := []string{`"v1"`, `"v2"`}[i]
+
+		httpmock.RegisterResponder(http.MethodGet, testChartURL, func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("If-None-Match") == etag {
+				return httpmock.NewStringResponse(http.StatusNotModified, ""), nil
+			}
+
+			resp := httpmock.NewBytesResponse(http.StatusOK, archive)
+			resp.Header.Set("ETag", etag)
+
+			return resp, nil
+		})
+
+		chartPath, status, err := s.downloadCachedChart(context.Background(), testChartURL)
+		if err != nil {
+			t.Fatalf("Service.downloadCachedChart() error = %v", err)
+		}
+
+		defer os.Remove(chartPath)
+
+		metadata, err := inspectChartArchive(chartPath)
+		if err != nil {
+			t.Fatalf("inspectChartArchive() error = %v", err)
+		}
+
+		if status != domain.CacheStatusMiss || metadata.Version != []string{"1.0.0", "2.0.0"}[i] {
+			t.Errorf("Service.downloadCachedChart() = %v %v, want a fresh download of version %d", status, metadata.Version, i+1)
+		}
+	}
+}
+
+func TestService_renderCachedChart(t *testing.T) {
+	logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+	s := NewHelmService(logger, WithChartCache(openTestCache(t), DefaultChartCacheTTL, DefaultChartCacheMaxSize))
+
+	chart := &domain.ChartDetails{Digest: "sha256:aaaa"}
+
+	values := &renderValues{set: []string{"image.tag=1.25"}}
+
+	valuesDigest, err := values.digest()
+	if err != nil {
+		t.Fatalf("renderValues.digest() error = %v", err)
+	}
+
+	rendered := []renderedTemplate{{
+		Name:     "web/templates/pod.yaml",
+		Manifest: "kind: Pod\nspec:\n  containers:\n    - name: web\n      image: nginx:1.25\n",
+	}}
+
+	s.cacheChartDocument(chartRenderBucket, chart.Digest+"|"+valuesDigest, rendered)
+
+	got, err := s.renderCachedChart(context.Background(), chart, "missing-chart.tgz", values)
+	if err != nil {
+		t.Fatalf("Service.renderCachedChart() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, rendered) || chart.RenderCache != domain.CacheStatusHit {
+		t.Errorf("Service.renderCachedChart() = %+v with cache %v", got, chart.RenderCache)
+	}
+}
+
+func TestService_chartCacheBounds(t *testing.T) {
+	archive := make([]byte, 1000)
+
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		maxSize   int64
+		wait      time.Duration
+		wantKept  []string
+		wantEvict []string
+	}{
+		{
+			name:     "success: within the bounds",
+			ttl:      time.Hour,
+			maxSize:  1 << 20,
+			wantKept: []string{"first", "second", "third"},
+		},
+		{
+			name:      "success: oldest evicted beyond the size",
+			ttl:       time.Hour,
+			maxSize:   2500,
+			wantKept:  []string{"second", "third"},
+			wantEvict: []string{"first"},
+		},
+		{
+			name:      "success: expired entries pruned",
+			ttl:       20 * time.Millisecond,
+			maxSize:   1 << 20,
+			wait:      30 * time.Millisecond,
+			wantKept:  []string{"third"},
+			wantEvict: []string{"first", "second"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, WithChartCache(openTestCache(t), tt.ttl, tt.maxSize))
+
+			for _, key := range []string{"first", "second"} {
+				s.cacheChartEntry(chartArchiveBucket, key, archive)
+
+				time.Sleep(time.Millisecond)
+			}
+
+			time.Sleep(tt.wait)
+
+			s.cacheChartEntry(chartArchiveBucket, "third", archive)
+
+			for _, key := range tt.wantKept {
+				if _, ok := s.cachedArchive(key); !ok {
+					t.Errorf("Service.cacheChartEntry() evicted %s", key)
+				}
+			}
+
+			for _, key := range tt.wantEvict {
+				if _, ok := s.cachedArchive(key); ok {
+					t.Errorf("Service.cacheChartEntry() kept %s", key)
+				}
+			}
+
+			if stored, err := s.chartCache.DeletePrefix(chartArchiveBucket, ""); err != nil || stored != len(tt.wantKept) {
+				t.Errorf("Service.cacheChartEntry() left %d entries stored, want %d", stored, len(tt.wantKept))
+			}
+		})
+	}
+}
+
+func TestService_PurgeChartCache(t *testing.T) {
+	logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+	if _, err := NewHelmService(logger).PurgeChartCache(context.Background()); err == nil {
+		t.Errorf("Service.PurgeChartCache() without a chart cache succeeded")
+	}
+
+	s := NewHelmService(logger, WithChartCache(openTestCache(t), DefaultChartCacheTTL, DefaultChartCacheMaxSize))
+
+	s.cacheChartEntry(chartArchiveBucket, "sha256:aaaa", []byte{0x1f, 0x8b})
+	s.cacheChartDocument(chartURLBucket, testChartURL, &chartValidators{ETag: `"v1"`, Digest: "sha256:aaaa"})
+	s.cacheChartDocument(chartRenderBucket, "sha256:aaaa|values", []renderedTemplate{{Name: "web/templates/pod.yaml"}})
+
+	result, err := s.PurgeChartCache(context.Background())
+	if err != nil || result.Purged != 3 {
+		t.Fatalf("Service.PurgeChartCache() = %+v, %v, want 3 entries purged", result, err)
+	}
+
+	if _, ok := s.cachedArchive("sha256:aaaa"); ok || s.cachedValidators(testChartURL) != nil {
+		t.Errorf("Service.PurgeChartCache() left cached entries behind")
+	}
+}
+
+func TestService_ProcessHelmChart_streamedWithChartCache(t *testing.T) {
+	archive := buildChartArchive(t, map[string]string{
+		"redis/Chart.yaml":               testChartYAML,
+		"redis/templates/configmap.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: redis\n",
+	})
+
+	logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+	s := NewHelmService(logger, WithChartCache(openTestCache(t), DefaultChartCacheTTL, DefaultChartCacheMaxSize))
+
+	httpmock.ActivateNonDefault(s.httpClient)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodGet, testChartURL, httpmock.NewBytesResponder(http.StatusOK, archive))
+
+	// Events are encoded on another goroutine while the scan goes on, as the stream handler does.
+	events := make(chan *domain.ScanEvent, 16)
+	encoded := make(chan []string)
+
+	go func() {
+		var charts []string
+
+		for event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				t.Errorf("json.Marshal() error = %v", err)
+			}
+
+			if event.Chart != nil {
+				charts = append(charts, string(data))
+			}
+		}
+
+		encoded <- charts
+	}()
+
+	ctx := domain.WithScanEvents(context.Background(), func(event *domain.ScanEvent) { events <- event })
+
+	for range 2 {
+		if _, err := s.ProcessHelmChart(ctx, &domain.HelmLinkInput{Path: testChartURL}); err != nil {
+			t.Fatalf("Service.ProcessHelmChart() error = %v", err)
+		}
+	}
+
+	close(events)
+
+	if charts := <-encoded; len(charts) != 4 {
+		t.Errorf("Service.ProcessHelmChart() emitted %d chart events, want 4", len(charts))
+	}
+}
+
+func TestRenderValues_digest(t *testing.T) {
+	first, err := writeValuesFile([]byte("replicaCount: 1\n"))
+	if err != nil {
+		t.Fatalf("writeValuesFile() error = %v", err)
+	}
+
+	defer os.Remove(first)
+
+	second, err := writeValuesFile([]byte("replicaCount: 2\n"))
+	if err != nil {
+		t.Fatalf("writeValuesFile() error = %v", err)
+	}
+
+	defer os.Remove(second)
+
+	digests := map[string]string{}
+
+	for name, values := range map[string]*renderValues{
+		"none":           {},
+		"first":          {files: []string{first}},
+		"second":         {files: []string{second}},
+		"both":           {files: []string{first, second}},
+		"both reversed":  {files: []string{second, first}},
+		"set":            {set: []string{"a=b"}},
+		"set split":      {set: []string{"a", "=b"}},
+		"first with set": {files: []string{first}, set: []string{"a=b"}},
+	} {
+		digest, err := values.digest()
+		if err != nil {
+			t.Fatalf("renderValues.digest() error = %v", err)
+		}
+
+		if other, ok := digests[digest]; ok {
+			t.Errorf("renderValues.digest() of %q equals the digest of %q", name, other)
+		}
+
+		digests[digest] = name
+	}
+}
@@ -0,0 +1,173 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/application/helpers"
+)
+
+// DefaultMaxRedirects is the number of redirects followed when downloading charts, indexes and values files
+const DefaultMaxRedirects = 5
+
+// errBlockedAddress is returned when a chart download would connect to a non-public address
+var errBlockedAddress = errors.New("connection to non-public address blocked")
+
+// blockedPrefixes are the ranges chart downloads may not connect to, on top of the loopback, private,
+// link-local, multicast and unspecified addresses, unless they are explicitly allowed.
+// Link-local covers the 169.254.169.254 metadata endpoint.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// WithMaxRedirects bounds the number of redirects followed by chart downloads. Zero follows none.
+func WithMaxRedirects(redirects int) Option {
+	return func(s *Service) {
+		s.maxRedirects = max(redirects, 0)
+	}
+}
+
+// WithAllowedNetworks lets chart downloads and image lookups connect to the given ranges even though
+// they are not public, such as the network of an internal chart repository or registry.
+func WithAllowedNetworks(networks []netip.Prefix) Option {
+	return func(s *Service) {
+		s.allowedNetworks = networks
+	}
+}
+
+// ParseNetworks parses a comma separated list of CIDR ranges or single addresses.
+func ParseNetworks(value string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+			}
+
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+
+			continue
+		}
+
+		network, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+		}
+
+		networks = append(networks, network.Masked())
+	}
+
+	return networks, nil
+}
+
+// isPublicAddress reports whether addr is a publicly routable address.
+func isPublicAddress(addr netip.Addr) bool {
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// dialGuard rejects connections to non-public addresses outside the allowed networks. It runs
+// after DNS resolution, for every address dialed, so hosts resolving to internal addresses are
+// caught as well.
+type dialGuard struct {
+	allowed []netip.Prefix
+}
+
+// control is used as the net.Dialer Control function.
+func (g *dialGuard) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	addr = addr.Unmap().WithZone("")
+
+	if isPublicAddress(addr) {
+		return nil
+	}
+
+	for _, network := range g.allowed {
+		if network.Contains(addr) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", errBlockedAddress, addr)
+}
+
+// newGuardedTransport returns the transport used to download charts, whether over HTTP(S) or from
+// OCI registries, and to look up images. Connections to non-public addresses outside allowedNetworks are refused. Proxies
+// are not used, since the guard could only check the address of the proxy.
+func newGuardedTransport(allowedNetworks []netip.Prefix) *http.Transport {
+	guard := &dialGuard{allowed: allowedNetworks}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   guard.control,
+	}
+
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// newHTTPClient returns the client used to download charts, repository indexes and values files
+// over transport. Requests taking longer than timeout, including reading the body, are canceled.
+// Every redirect is checked against the trusted chart sources and at most maxRedirects are followed.
+func newHTTPClient(timeout time.Duration, maxRedirects int, transport http.RoundTripper) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+
+			if _, err := helpers.ValidateURL(req.URL.String()); err != nil {
+				return fmt.Errorf("redirect rejected: %w", err)
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,315 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/jarcoal/httpmock"
+)
+
+// withLoopback lets the service connect to the registries and servers tests start on loopback
+func withLoopback() Option {
+	return WithAllowedNetworks([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})
+}
+
+func TestService_httpGet_redirects(t *testing.T) {
+	const chartURL = "https://charts.bitnami.com/bitnami/redis-20.6.1.tgz"
+
+	tests := []struct {
+		name     string
+		location string
+		opts     []Option
+		wantErr  bool
+	}{
+		{
+			name:     "success: redirect to trusted source",
+			location: "https://github.com/bitnami/charts/releases/download/redis-20.6.1.tgz",
+		},
+		{
+			name:     "success: redirects up to the limit",
+			location: "https://charts.bitnami.com/hop/4",
+		},
+		{
+			name:     "fail: redirect to untrusted source",
+			location: "https://evil.example/redis-20.6.1.tgz",
+			wantErr:  true,
+		},
+		{
+			name:     "fail: redirect to lookalike source",
+			location: "https://github.com.evil.example/redis-20.6.1.tgz",
+			wantErr:  true,
+		},
+		{
+			name:     "fail: redirect to metadata endpoint",
+			location: "http://169.254.169.254/latest/meta-data/",
+			wantErr:  true,
+		},
+		{
+			name:     "fail: redirects beyond the limit",
+			location: "https://charts.bitnami.com/hop/5",
+			wantErr:  true,
+		},
+		{
+			name:     "fail: redirects disabled",
+			location: "https://github.com/bitnami/charts/releases/download/redis-20.6.1.tgz",
+			opts:     []Option{WithMaxRedirects(0)},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, tt.opts...)
+
+			httpmock.ActivateNonDefault(s.httpClient)
+			defer httpmock.DeactivateAndReset()
+
+			redirect := func(location string) httpmock.Responder {
+				return func(_ *http.Request) (*http.Response, error) {
+					resp := httpmock.NewStringResponse(http.StatusFound, "")
+					resp.Header.Set("Location", location)
+
+					return resp, nil
+				}
+			}
+
+			httpmock.RegisterResponder(http.MethodGet, chartURL, redirect(tt.location))
+
+			for hop := 1; hop <= 5; hop++ {
+				httpmock.RegisterResponder(http.MethodGet, fmt.Sprintf("https://charts.bitnami.com/hop/%d", hop),
+					redirect(fmt.Sprintf("https://charts.bitnami.com/hop/%d", hop-1)))
+			}
+
+			httpmock.RegisterResponder(http.MethodGet, "https://charts.bitnami.com/hop/0",
+				httpmock.NewStringResponder(http.StatusOK, "chart"))
+			httpmock.RegisterResponder(http.MethodGet, "https://github.com/bitnami/charts/releases/download/redis-20.6.1.tgz",
+				httpmock.NewStringResponder(http.StatusOK, "chart"))
+			httpmock.RegisterNoResponder(httpmock.NewStringResponder(http.StatusOK, "untrusted"))
+
+			resp, err := s.httpGet(context.Background(), chartURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.httpGet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err == nil {
+				resp.Body.Close()
+			}
+		})
+	}
+}
+
+func TestService_httpGet_blockedAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("chart"))
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{
+			name:    "fail: loopback blocked by default",
+			wantErr: true,
+		},
+		{
+			name: "success: loopback allowed",
+			opts: []Option{WithAllowedNetworks([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})},
+		},
+		{
+			name:    "fail: other network allowed",
+			opts:    []Option{WithAllowedNetworks([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, tt.opts...)
+
+			resp, err := s.httpGet(context.Background(), server.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.httpGet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				if !errors.Is(err, errBlockedAddress) {
+					t.Errorf("Service.httpGet() error = %v, want %v", err, errBlockedAddress)
+				}
+
+				return
+			}
+
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestService_pullOCIChart_blockedAddresses(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+
+	reference := fmt.Sprintf("%s/charts/hello-world:0.1.0", strings.TrimPrefix(server.URL, "http://"))
+
+	pushOCIArtifact(t, reference, []byte("fake chart tarball"), helmChartContentMediaType)
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{
+			name:    "fail: loopback blocked by default",
+			wantErr: true,
+		},
+		{
+			name: "success: loopback allowed",
+			opts: []Option{WithAllowedNetworks([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})},
+		},
+		{
+			name:    "fail: other network allowed",
+			opts:    []Option{WithAllowedNetworks([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, tt.opts...)
+
+			chartPath, err := s.pullOCIChart(context.Background(), ociScheme+reference)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.pullOCIChart() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				if !errors.Is(err, errBlockedAddress) {
+					t.Errorf("Service.pullOCIChart() error = %v, want %v", err, errBlockedAddress)
+				}
+
+				return
+			}
+
+			os.Remove(chartPath)
+		})
+	}
+}
+
+func TestService_fetchImageDetails_blockedAddresses(t *testing.T) {
+	image := newTestRegistry(t) + "/apps/web:1.0.0"
+
+	pushRandomImage(t, image, 1)
+
+	tests := []struct {
+		name    string
+		image   string
+		opts    []Option
+		wantErr bool
+	}{
+		{
+			name:    "fail: loopback blocked by default",
+			image:   image,
+			wantErr: true,
+		},
+		{
+			name:    "fail: loopback blocked with the image cache",
+			image:   image,
+			opts:    []Option{WithImageCache(openTestCache(t), DefaultTagTTL)},
+			wantErr: true,
+		},
+		{
+			name:    "fail: private registry blocked",
+			image:   "10.20.0.5:5000/apps/web:1.0.0",
+			wantErr: true,
+		},
+		{
+			name:  "success: loopback allowed",
+			image: image,
+			opts:  []Option{withLoopback()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, tt.opts...)
+
+			_, err := s.fetchImageDetails(context.Background(), tt.image, &lookupOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.fetchImageDetails() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, errBlockedAddress) {
+				t.Errorf("Service.fetchImageDetails() error = %v, want %v", err, errBlockedAddress)
+			}
+		})
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "140.82.121.4", want: true},
+		{addr: "2606:50c0:8000::153", want: true},
+		{addr: "127.0.0.1"},
+		{addr: "10.1.2.3"},
+		{addr: "172.16.0.1"},
+		{addr: "192.168.1.1"},
+		{addr: "169.254.169.254"},
+		{addr: "100.100.100.200"},
+		{addr: "0.0.0.0"},
+		{addr: "::1"},
+		{addr: "fd00:ec2::254"},
+		{addr: "fe80::1"},
+		{addr: "64:ff9b::a9fe:a9fe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := isPublicAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("isPublicAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	got, err := ParseNetworks(" 10.0.0.0/8, 192.168.1.10 ,fd00::1/64,")
+	if err != nil {
+		t.Fatalf("ParseNetworks() error = %v", err)
+	}
+
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.10/32"),
+		netip.MustParsePrefix("fd00::/64"),
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ParseNetworks() = %v, want %v", got, want)
+	}
+
+	if _, err := ParseNetworks("10.0.0.0/33"); err == nil {
+		t.Errorf("ParseNetworks() of an invalid range did not fail")
+	}
+}
@@ -0,0 +1,219 @@
+package helm
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v3"
+)
+
+// Credentials authenticate requests to a registry or chart repository. A Token is sent as a
+// bearer token, otherwise Username and Password are sent using basic auth.
+type Credentials struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+}
+
+// ChartCredentials authenticate chart downloads from URLs below URL
+type ChartCredentials struct {
+	URL         string `yaml:"url"`
+	Credentials `yaml:",inline"`
+}
+
+// RegistryConfig configures access to private container registries and chart repositories.
+// Registries is keyed by registry host, such as ghcr.io or harbor.example.com:8443.
+// Mirrors are tried in order and the first matching rule rewrites an image.
+type RegistryConfig struct {
+	Registries map[string]Credentials `yaml:"registries"`
+	Charts     []ChartCredentials     `yaml:"charts"`
+	Mirrors    []MirrorRule           `yaml:"mirrors"`
+}
+
+// DefaultLookupConcurrency is the number of image lookups run in parallel for a chart
+const DefaultLookupConcurrency = 8
+
+// DefaultBatchConcurrency is the number of charts of a batch processed in parallel
+const DefaultBatchConcurrency = 4
+
+// Option configures a Service
+type Option func(*Service)
+
+// WithLookupConcurrency bounds the number of image lookups run in parallel for a chart.
+func WithLookupConcurrency(concurrency int) Option {
+	return func(s *Service) {
+		s.lookupConcurrency = max(concurrency, 1)
+	}
+}
+
+// WithBatchConcurrency bounds the number of charts of a batch processed in parallel.
+func WithBatchConcurrency(concurrency int) Option {
+	return func(s *Service) {
+		s.batchConcurrency = max(concurrency, 1)
+	}
+}
+
+// WithLookupTimeout bounds the time spent looking up the images of a chart. Images that are
+// not looked up in time are reported as timed out, and the rest of the results are returned.
+func WithLookupTimeout(timeout time.Duration) Option {
+	return func(s *Service) {
+		s.lookupTimeout = timeout
+	}
+}
+
+// WithRegistryConfig authenticates image lookups and chart downloads with the configured credentials
+// and looks images up through the configured mirrors. Registries without static credentials fall back
+// to the Docker config keychain. The config is expected to come from LoadRegistryConfig.
+func WithRegistryConfig(config *RegistryConfig) Option {
+	return func(s *Service) {
+		s.keychain = authn.NewMultiKeychain(staticKeychain(config.Registries), authn.DefaultKeychain)
+		s.chartCredentials = config.Charts
+		s.mirrors = config.Mirrors
+	}
+}
+
+// envReference matches the ${NAME} environment variable references expanded in registry configs.
+// Bare $NAME references are left alone since registry usernames such as robot$scanner contain a $.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// LoadRegistryConfig reads a RegistryConfig from a YAML file. Environment variables referenced
+// as ${NAME} are expanded so secrets do not have to be stored in the file.
+func LoadRegistryConfig(path string) (*RegistryConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry config: %w", err)
+	}
+
+	config := &RegistryConfig{}
+
+	expanded := envReference.ReplaceAllFunc(content, func(reference []byte) []byte {
+		return []byte(os.Getenv(string(envReference.FindSubmatch(reference)[1])))
+	})
+
+	err = yaml.Unmarshal(expanded, config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry config: %w", err)
+	}
+
+	registries := make(map[string]Credentials, len(config.Registries))
+
+	for host, credentials := range config.Registries {
+		if err := credentials.validate(); err != nil {
+			return nil, fmt.Errorf("invalid credentials for registry %s: %w", host, err)
+		}
+
+		registry, err := name.NewRegistry(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid registry %s: %w", host, err)
+		}
+
+		registries[registry.RegistryStr()] = credentials
+	}
+
+	config.Registries = registries
+
+	for _, chart := range config.Charts {
+		if err := chart.validate(); err != nil {
+			return nil, fmt.Errorf("invalid credentials for chart repository %s: %w", chart.URL, err)
+		}
+
+		base, err := url.Parse(chart.URL)
+		if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+			return nil, fmt.Errorf("invalid chart repository URL %s", chart.URL)
+		}
+	}
+
+	for i := range config.Mirrors {
+		if err := config.Mirrors[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid mirror rule %d: %w", i+1, err)
+		}
+	}
+
+	return config, nil
+}
+
+// validate checks that exactly one authentication method is configured.
+func (c *Credentials) validate() error {
+	if c.Token != "" && (c.Username != "" || c.Password != "") {
+		return fmt.Errorf("token cannot be combined with username and password")
+	}
+
+	if c.Token == "" && c.Username == "" {
+		return fmt.Errorf("either a token or a username is required")
+	}
+
+	return nil
+}
+
+// authConfig converts the credentials for use with the container registry API.
+func (c *Credentials) authConfig() authn.AuthConfig {
+	if c.Token != "" {
+		return authn.AuthConfig{RegistryToken: c.Token}
+	}
+
+	return authn.AuthConfig{Username: c.Username, Password: c.Password}
+}
+
+// authorize adds the credentials to an HTTP request.
+func (c *Credentials) authorize(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+		return
+	}
+
+	req.SetBasicAuth(c.Username, c.Password)
+}
+
+// matches reports how specific the credentials are for target, or -1 if they do not apply.
+// Credentials apply to URLs on the same scheme and host whose path is below the configured path.
+func (c *ChartCredentials) matches(target *url.URL) int {
+	base, err := url.Parse(c.URL)
+	if err != nil || base.Scheme != target.Scheme || !strings.EqualFold(base.Host, target.Host) {
+		return -1
+	}
+
+	prefix := strings.TrimSuffix(base.Path, "/")
+	if target.Path != prefix && !strings.HasPrefix(target.Path, prefix+"/") {
+		return -1
+	}
+
+	return len(prefix)
+}
+
+// staticKeychain resolves credentials configured per registry host
+type staticKeychain map[string]Credentials
+
+// Resolve implements authn.Keychain.
+func (k staticKeychain) Resolve(resource authn.Resource) (authn.Authenticator, error) { //nolint:ireturn // required by authn.Keychain
+	credentials, ok := k[resource.RegistryStr()]
+	if !ok {
+		return authn.Anonymous, nil
+	}
+
+	return authn.FromConfig(credentials.authConfig()), nil
+}
+
+// authorizeChartRequest adds the credentials of the most specific matching chart repository to req.
+func (s *Service) authorizeChartRequest(req *http.Request) {
+	var (
+		selected *ChartCredentials
+		longest  = -1
+	)
+
+	for i := range s.chartCredentials {
+		if length := s.chartCredentials[i].matches(req.URL); length > longest {
+			selected, longest = &s.chartCredentials[i], length
+		}
+	}
+
+	if selected != nil {
+		selected.authorize(req)
+	}
+}
@@ -0,0 +1,285 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/jarcoal/httpmock"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+// newAuthenticatedRegistry starts an in-process registry that only accepts requests carrying authorization,
+// answering others with the given WWW-Authenticate challenge
+func newAuthenticatedRegistry(t *testing.T, authorization, challenge string) string {
+	t.Helper()
+
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != authorization {
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// writeRegistryConfig writes content to a registry config file and returns its path
+func writeRegistryConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "registries.yaml")
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write registry config: %v", err)
+	}
+
+	return path
+}
+
+func TestLoadRegistryConfig(t *testing.T) {
+	t.Setenv("TEST_HARBOR_PASSWORD", "s3cret")
+
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]Credentials
+		wantErr bool
+	}{
+		{
+			name: "success: registries and charts",
+			content: `registries:
+  docker.io:
+    username: robot$scanner
+    password: ${TEST_HARBOR_PASSWORD}
+  ghcr.io:
+    token: ghp_token
+charts:
+  - url: https://charts.example.com/private
+    username: robot
+    password: ${TEST_HARBOR_PASSWORD}
+`,
+			want: map[string]Credentials{
+				"index.docker.io": {Username: "robot$scanner", Password: "s3cret"},
+				"ghcr.io":         {Token: "ghp_token"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "fail: invalid mirror rule",
+			content: `mirrors:
+  - prefix: docker.io/*
+`,
+			wantErr: true,
+		},
+		{
+			name:    "fail: malformed yaml",
+			content: "registries: [unclosed\n",
+			wantErr: true,
+		},
+		{
+			name: "fail: token combined with username",
+			content: `registries:
+  ghcr.io:
+    username: robot
+    token: ghp_token
+`,
+			wantErr: true,
+		},
+		{
+			name: "fail: registry without credentials",
+			content: `registries:
+  ghcr.io: {}
+`,
+			wantErr: true,
+		},
+		{
+			name: "fail: chart repository is not an http url",
+			content: `charts:
+  - url: oci://ghcr.io/charts
+    token: ghp_token
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadRegistryConfig(writeRegistryConfig(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadRegistryConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if len(got.Registries) != len(tt.want) {
+				t.Errorf("LoadRegistryConfig() registries = %+v, want %+v", got.Registries, tt.want)
+			}
+
+			for host, credentials := range tt.want {
+				if got.Registries[host] != credentials {
+					t.Errorf("LoadRegistryConfig() registry %s = %+v, want %+v", host, got.Registries[host], credentials)
+				}
+			}
+		})
+	}
+}
+
+func TestService_fetchImageDetails_authenticated(t *testing.T) {
+	host := newAuthenticatedRegistry(t, "Basic cm9ib3Q6czNjcmV0", `Basic realm="test"`)
+	tokenHost := newAuthenticatedRegistry(t, "Bearer registry-token", fmt.Sprintf(`Bearer realm="http://%s/token"`, host))
+
+	image := fmt.Sprintf("%s/private/app:1.0.0", host)
+	tokenImage := fmt.Sprintf("%s/private/app:1.0.0", tokenHost)
+
+	config := &RegistryConfig{
+		Registries: map[string]Credentials{
+			host:      {Username: "robot", Password: "s3cret"},
+			tokenHost: {Token: "registry-token"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		image      string
+		opts       []Option
+		wantStatus domain.ImageStatus
+	}{
+		{
+			name:       "success: static credentials",
+			image:      image,
+			opts:       []Option{WithRegistryConfig(config)},
+			wantStatus: domain.ImageStatusOK,
+		},
+		{
+			name:       "success: static bearer token",
+			image:      tokenImage,
+			opts:       []Option{WithRegistryConfig(config)},
+			wantStatus: domain.ImageStatusOK,
+		},
+		{
+			name:       "fail: anonymous",
+			image:      image,
+			opts:       nil,
+			wantStatus: domain.ImageStatusUnauthorized,
+		},
+		{
+			name:  "fail: wrong credentials",
+			image: image,
+			opts: []Option{WithRegistryConfig(&RegistryConfig{
+				Registries: map[string]Credentials{
+					host: {Username: "robot", Password: "wrong"},
+				},
+			})},
+			wantStatus: domain.ImageStatusUnauthorized,
+		},
+	}
+
+	pushRandomImage(t, image, 1, remote.WithAuth(&authn.Basic{Username: "robot", Password: "s3cret"}))
+	pushRandomImage(t, tokenImage, 1, remote.WithAuth(&authn.Bearer{Token: "registry-token"}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, append(tt.opts, withLoopback())...)
+
+			got := s.lookupImage(context.Background(), &imageUsage{image: tt.image, reference: normalizeImage(tt.image)}, &lookupOptions{})
+
+			if got.Status != tt.wantStatus {
+				t.Errorf("Service.lookupImage() status = %v, want %v (error: %s)", got.Status, tt.wantStatus, got.Error)
+			}
+		})
+	}
+}
+
+func TestService_httpGet_chartCredentials(t *testing.T) {
+	config := &RegistryConfig{
+		Charts: []ChartCredentials{
+			{URL: "https://charts.example.com/private", Credentials: Credentials{Username: "robot", Password: "s3cret"}},
+			{URL: "https://charts.example.com/private/team", Credentials: Credentials{Token: "team-token"}},
+		},
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "basic auth below repository",
+			url:  "https://charts.example.com/private/index.yaml",
+			want: "Basic cm9ib3Q6czNjcmV0",
+		},
+		{
+			name: "most specific repository wins",
+			url:  "https://charts.example.com/private/team/app-1.0.0.tgz",
+			want: "Bearer team-token",
+		},
+		{
+			name: "path prefix must match a whole segment",
+			url:  "https://charts.example.com/private-other/index.yaml",
+			want: "",
+		},
+		{
+			name: "other host",
+			url:  "https://charts.example.org/private/index.yaml",
+			want: "",
+		},
+		{
+			name: "other scheme",
+			url:  "http://charts.example.com/private/index.yaml",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, WithRegistryConfig(config), withLoopback())
+
+			httpmock.ActivateNonDefault(s.httpClient)
+			defer httpmock.DeactivateAndReset()
+
+			var got string
+
+			httpmock.RegisterNoResponder(func(req *http.Request) (*http.Response, error) {
+				got = req.Header.Get("Authorization")
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			})
+
+			resp, err := s.httpGet(context.Background(), tt.url)
+			if err != nil {
+				t.Errorf("Service.httpGet() error = %v", err)
+				return
+			}
+
+			resp.Body.Close()
+
+			if got != tt.want {
+				t.Errorf("Service.httpGet() authorization = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
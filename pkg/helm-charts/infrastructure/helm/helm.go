@@ -2,79 +2,270 @@ package helm
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
-	"os/exec"
 	"strings"
-	"sync"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/infrastructure/cache"
+)
+
+const (
+	// ociScheme prefixes chart references that are stored in an OCI registry
+	ociScheme = "oci://"
+
+	// helmChartContentMediaType is the media type of the layer holding a packaged chart
+	helmChartContentMediaType types.MediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
 )
 
 // Service encapsulates the logic for processing Helm charts and fetching image details.
 type Service struct {
 	logger *log.Logger
+
+	keychain         authn.Keychain
+	chartCredentials []ChartCredentials
+	mirrors          []MirrorRule
+
+	lookupConcurrency int
+	lookupTimeout     time.Duration
+	batchConcurrency  int
+
+	cache  *cache.Cache
+	tagTTL time.Duration
+
+	chartCache        *cache.Cache
+	chartCacheTTL     time.Duration
+	chartCacheMaxSize int64
+
+	httpClient        *http.Client
+	registryTransport http.RoundTripper
+	maxRedirects      int
+	allowedNetworks   []netip.Prefix
+	downloadTimeout   time.Duration
+
+	limits ArchiveLimits
+
+	renderer          renderer
+	renderConcurrency int
 }
 
 // NewHelmService initializes and returns a new Service instance.
-func NewHelmService(logger *log.Logger) *Service {
-	return &Service{
-		logger: logger,
+// Registry credentials are read from the Docker config unless configured otherwise, and chart
+// downloads and image lookups only connect to public addresses unless other networks are allowed.
+func NewHelmService(logger *log.Logger, opts ...Option) *Service {
+	s := &Service{
+		logger:            logger,
+		keychain:          authn.DefaultKeychain,
+		lookupConcurrency: DefaultLookupConcurrency,
+		batchConcurrency:  DefaultBatchConcurrency,
+		maxRedirects:      DefaultMaxRedirects,
+		renderConcurrency: DefaultRenderConcurrency,
+		downloadTimeout:   DefaultDownloadTimeout,
+		limits: ArchiveLimits{
+			MaxArchiveSize:      DefaultMaxArchiveSize,
+			MaxDecompressedSize: DefaultMaxDecompressedSize,
+			MaxFiles:            DefaultMaxArchiveFiles,
+			MaxIndexSize:        DefaultMaxIndexSize,
+		},
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.renderer == nil {
+		s.renderer = newSdkRenderer(s.renderConcurrency)
+	}
+
+	transport := newGuardedTransport(s.allowedNetworks)
+
+	s.httpClient = newHTTPClient(s.downloadTimeout, s.maxRedirects, transport)
+	s.registryTransport = transport
+
+	return s
 }
 
-// fetchImageDetails retrieves image metadata using the container registry API.
-func (s *Service) fetchImageDetails(image string) (*domain.ImageDetails, error) {
+// remoteOptions are the options of every registry request: ctx, the registry credentials and the
+// transport refusing connections to non-public addresses outside the allowed networks.
+func (s *Service) remoteOptions(ctx context.Context) []remote.Option {
+	return []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(s.keychain),
+		remote.WithTransport(s.registryTransport),
+	}
+}
+
+// fetchImageDetails retrieves image metadata using the container registry API, from the image cache
+// when one is configured. Multi-architecture images report every platform, or only the platforms
+// matching opts.platform.
+func (s *Service) fetchImageDetails(ctx context.Context, image string, opts *lookupOptions) (*domain.ImageDetails, error) {
 	ref, err := name.ParseReference(image)
 	if err != nil {
 		return nil, err
 	}
 
-	img, err := remote.Image(ref)
+	if s.cache != nil {
+		return s.fetchCachedImageDetails(ctx, image, ref, opts)
+	}
+
+	desc, err := remote.Get(ref, s.remoteOptions(ctx)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.describeImage(image, desc, opts)
+}
+
+// describeImage sums the layers of an image, or of every platform of a multi-architecture image.
+func (s *Service) describeImage(image string, desc *remote.Descriptor, opts *lookupOptions) (*domain.ImageDetails, error) {
+	if desc.MediaType.IsIndex() {
+		details, err := s.fetchIndexDetails(image, desc, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		details.Digest = desc.Digest.String()
+
+		return details, nil
+	}
+
+	img, err := desc.Image()
 	if err != nil {
 		return nil, err
 	}
 
-	manifest, err := img.Manifest()
+	size, layers, err := manifestSize(img)
 	if err != nil {
 		return nil, err
 	}
 
-	size := int64(0)
-	for _, layer := range manifest.Layers {
-		size += layer.Size
+	details := &domain.ImageDetails{
+		Image:        image,
+		Digest:       desc.Digest.String(),
+		Size:         size,
+		Layers:       len(layers),
+		LayerDetails: layers,
 	}
 
-	return &domain.ImageDetails{
-		Image:  image,
-		Size:   size,
-		Layers: len(manifest.Layers),
-	}, nil
+	if err := inspectImage(img, details, opts); err != nil {
+		return nil, err
+	}
+
+	return details, nil
 }
 
-// downloadHelmChart downloads a Helm chart from a URL and saves it locally.
-func (s *Service) downloadHelmChart(ctx context.Context, url string) (string, error) {
+// httpGet performs a GET request, authenticated with the matching chart repository credentials,
+// and returns the response if the server answered with 200 OK.
+// The caller is responsible for closing the response body.
+func (s *Service) httpGet(ctx context.Context, url string) (*http.Response, error) {
+	return s.conditionalGet(ctx, url, nil)
+}
+
+// conditionalGet behaves like httpGet, but revalidates a cached response when validators are given,
+// in which case a 304 Not Modified response is returned as well.
+func (s *Service) conditionalGet(ctx context.Context, url string, validators *chartValidators) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req) // codeql:ignore
+	s.authorizeChartRequest(req)
+
+	if validators != nil {
+		validators.apply(req)
+	}
+
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	defer resp.Body.Close()
+	if validators != nil && resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to download Helm chart: received status code %d", resp.StatusCode)
+		resp.Body.Close()
+
+		return nil, fmt.Errorf("received status code %d", resp.StatusCode)
 	}
 
+	return resp, nil
+}
+
+// downloadHelmChart downloads a Helm chart from a URL and saves it locally.
+func (s *Service) downloadHelmChart(ctx context.Context, url string) (string, error) {
+	resp, err := s.httpGet(ctx, url)
+	if err != nil {
+		return "", fmt.Errorf("failed to download Helm chart: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	return s.saveHelmChart(resp.Body)
+}
+
+// pullOCIChart pulls a Helm chart published as an OCI artifact and saves its chart layer locally.
+func (s *Service) pullOCIChart(ctx context.Context, reference string) (string, error) {
+	ref, err := name.ParseReference(strings.TrimPrefix(reference, ociScheme))
+	if err != nil {
+		return "", fmt.Errorf("invalid OCI chart reference: %w", err)
+	}
+
+	if s.downloadTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, s.downloadTimeout)
+		defer cancel()
+	}
+
+	img, err := remote.Image(ref, s.remoteOptions(ctx)...)
+	if err != nil {
+		return "", fmt.Errorf("failed to pull Helm chart: %w", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return "", fmt.Errorf("failed to read Helm chart layers: %w", err)
+	}
+
+	for _, layer := range layers {
+		mediaType, err := layer.MediaType()
+		if err != nil {
+			return "", fmt.Errorf("failed to read layer media type: %w", err)
+		}
+
+		if mediaType != helmChartContentMediaType {
+			continue
+		}
+
+		content, err := layer.Compressed()
+		if err != nil {
+			return "", fmt.Errorf("failed to read Helm chart layer: %w", err)
+		}
+
+		defer content.Close()
+
+		return s.saveHelmChart(content)
+	}
+
+	return "", fmt.Errorf("no Helm chart layer found in %s", ref)
+}
+
+// saveHelmChart writes a packaged Helm chart of at most the maximum archive size to a temporary file
+// and returns its path. The caller is responsible for removing the file.
+func (s *Service) saveHelmChart(content io.Reader) (string, error) {
 	tmpFile, err := os.CreateTemp("", "helm-chart-*.tgz")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temporary file: %w", err)
@@ -82,77 +273,185 @@ func (s *Service) downloadHelmChart(ctx context.Context, url string) (string, er
 
 	defer tmpFile.Close()
 
-	_, err = io.Copy(tmpFile, resp.Body)
+	written, err := io.Copy(tmpFile, io.LimitReader(content, s.limits.MaxArchiveSize+1))
+	if err == nil && written > s.limits.MaxArchiveSize {
+		err = fmt.Errorf("%w of %d bytes", errArchiveTooLarge, s.limits.MaxArchiveSize)
+	}
+
 	if err != nil {
+		os.Remove(tmpFile.Name())
+
 		return "", fmt.Errorf("failed to write Helm chart to file: %w", err)
 	}
 
 	return tmpFile.Name(), nil
 }
 
-// parseHelmChart extracts image references from a Helm chart.
-func (s *Service) parseHelmChart(chartPath string) ([]string, error) {
-	cmd := exec.Command("helm", "template", chartPath)
+// fileDigest returns the hex encoded SHA-256 digest of the file at path.
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
 
-	output, err := cmd.CombinedOutput()
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
 	if err != nil {
-		return nil, fmt.Errorf("failed to render helm chart: %w", err)
+		return "", fmt.Errorf("failed to compute chart digest: %w", err)
 	}
 
-	var images []string
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
 
-	lines := strings.Split(string(output), "\n")
+// fetchHelmChart retrieves a Helm chart either from an OCI registry or over HTTP(S), recording
+// whether an HTTP(S) download was served from the chart cache.
+func (s *Service) fetchHelmChart(ctx context.Context, chart *domain.ChartDetails) (string, error) {
+	if strings.HasPrefix(chart.URL, ociScheme) {
+		return s.pullOCIChart(ctx, chart.URL)
+	}
 
-	for _, line := range lines {
-		if strings.Contains(line, "image:") {
-			imageParts := strings.Split(line, ": ")
-			if len(imageParts) > 1 {
-				image := strings.TrimSpace(imageParts[1])
-				image = strings.Trim(image, "\"")
-				images = append(images, image)
-			}
+	if s.chartCache != nil {
+		chartPath, status, err := s.downloadCachedChart(ctx, chart.URL)
+		if err != nil {
+			return "", err
 		}
+
+		chart.ArchiveCache = status
+
+		return chartPath, nil
 	}
 
-	return images, nil
+	return s.downloadHelmChart(ctx, chart.URL)
 }
 
-// ProcessChartHandler handles HTTP requests to process Helm charts.
-func (s *Service) ProcessHelmChart(ctx context.Context, path string) ([]*domain.ImageDetails, error) {
-	chartPath, err := s.downloadHelmChart(ctx, path)
+// parseHelmChart renders a Helm chart with the given values and extracts its image references.
+func (s *Service) parseHelmChart(ctx context.Context, chartPath string, values *renderValues) ([]imageReference, error) {
+	templates, err := s.renderer.render(ctx, chartPath, values)
 	if err != nil {
 		return nil, err
 	}
 
-	images, err := s.parseHelmChart(chartPath)
+	return extractImages(templates)
+}
+
+// ProcessHelmChart downloads a Helm chart, resolving it from its repository index when needed,
+// and returns the details of every image it references.
+func (s *Service) ProcessHelmChart(ctx context.Context, input *domain.HelmLinkInput) (*domain.ChartScanResult, error) {
+	chart := &domain.ChartDetails{URL: input.Path}
+
+	if input.RepoURL != "" {
+		resolved, err := s.resolveChart(ctx, input.RepoURL, input.Chart, input.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		chart = resolved
+	}
+
+	chartPath, err := s.fetchHelmChart(ctx, chart)
 	if err != nil {
 		return nil, err
 	}
 
-	var results []*domain.ImageDetails
+	defer os.Remove(chartPath)
 
-	var wg sync.WaitGroup
+	return s.processChartArchive(ctx, chart, chartPath, input)
+}
 
-	var mu sync.Mutex
+// ProcessHelmChartArchive saves an uploaded chart archive and returns the details of every image it references.
+func (s *Service) ProcessHelmChartArchive(ctx context.Context, archive io.Reader) (*domain.ChartScanResult, error) {
+	chartPath, err := s.saveHelmChart(archive)
+	if err != nil {
+		return nil, err
+	}
 
-	wg.Add(len(images))
+	defer os.Remove(chartPath)
 
-	for _, image := range images {
-		go func(image string) {
-			defer wg.Done()
+	return s.processChartArchive(ctx, &domain.ChartDetails{}, chartPath, &domain.HelmLinkInput{})
+}
 
-			details, err := s.fetchImageDetails(image)
-			if err != nil {
-				s.logger.Printf("Failed to fetch details for image %s: %v", image, err)
-			}
+// processChartArchive validates a locally stored chart archive against the archive limits, renders it
+// and looks up its images.
+func (s *Service) processChartArchive(
+	ctx context.Context, chart *domain.ChartDetails, chartPath string, input *domain.HelmLinkInput,
+) (*domain.ChartScanResult, error) {
+	opts, err := newLookupOptions(&input.ImageOptions)
+	if err != nil {
+		return nil, err
+	}
 
-			mu.Lock()
-			results = append(results, details)
-			mu.Unlock()
-		}(image)
+	if err := s.validateChartArchive(chartPath); err != nil {
+		return nil, err
+	}
+
+	metadata, err := inspectChartArchive(chartPath)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := fileDigest(chartPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if chart.Digest != "" && chart.Digest != digest {
+		return nil, fmt.Errorf("chart digest mismatch: index lists %s but downloaded archive is %s", chart.Digest, digest)
+	}
+
+	chart.Name = metadata.Name
+	chart.Version = metadata.Version
+	chart.Digest = fmt.Sprintf("sha256:%s", digest)
+
+	// Listeners may encode events on another goroutine while the scan keeps updating chart, so
+	// chart events carry a copy.
+	downloaded := *chart
+
+	domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventChartDownloaded, Chart: &downloaded})
+
+	values, err := s.prepareValues(ctx, &input.RenderOptions)
+	if err != nil {
+		return nil, err
 	}
 
-	wg.Wait()
+	defer values.cleanup()
+
+	rendered, err := s.renderCachedChart(ctx, chart, chartPath, values)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := extractImages(rendered)
+	if err != nil {
+		return nil, err
+	}
+
+	renderedChart := *chart
+
+	domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventChartRendered, Chart: &renderedChart})
+
+	usages := groupImages(images)
+
+	domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventImagesDiscovered, Images: len(usages)})
+
+	results, partial := s.lookupImages(ctx, usages, opts)
+
+	result := &domain.ChartScanResult{
+		Chart:   chart,
+		Partial: partial,
+		Summary: summarize(results),
+		Layers:  summarizeLayers(results),
+		Images:  results,
+	}
+
+	if input.PinDigests {
+		result.Pinning, err = suggestPins(chartPath, results)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	return results, nil
+	return result, nil
 }
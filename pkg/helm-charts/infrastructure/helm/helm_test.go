@@ -1,14 +1,50 @@
 package helm
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/jarcoal/httpmock"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
 )
 
+// pushOCIArtifact pushes a single layer artifact to the registry under reference
+func pushOCIArtifact(t *testing.T, reference string, content []byte, mediaType types.MediaType) {
+	t.Helper()
+
+	ref, err := name.ParseReference(reference)
+	if err != nil {
+		t.Fatalf("invalid reference %s: %v", reference, err)
+	}
+
+	img, err := mutate.AppendLayers(empty.Image, static.NewLayer(content, mediaType))
+	if err != nil {
+		t.Fatalf("failed to build artifact: %v", err)
+	}
+
+	img = mutate.MediaType(img, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, "application/vnd.cncf.helm.config.v1+json")
+
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("failed to push artifact: %v", err)
+	}
+}
+
 func TestService_fetchImageDetails(t *testing.T) {
 	type args struct {
 		image string
@@ -48,7 +84,7 @@ func TestService_fetchImageDetails(t *testing.T) {
 
 			s := NewHelmService(logger)
 
-			_, err := s.fetchImageDetails(tt.args.image)
+			_, err := s.fetchImageDetails(context.Background(), tt.args.image, &lookupOptions{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Service.fetchImageDetails() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -114,7 +150,7 @@ func TestService_downloadHelmChart(t *testing.T) {
 				})
 			}
 
-			httpmock.Activate()
+			httpmock.ActivateNonDefault(s.httpClient)
 			defer httpmock.DeactivateAndReset()
 
 			_, err := s.downloadHelmChart(tt.args.ctx, tt.args.url)
@@ -126,6 +162,93 @@ func TestService_downloadHelmChart(t *testing.T) {
 	}
 }
 
+func TestService_pullOCIChart(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	chartContent := []byte("fake chart tarball")
+
+	pushOCIArtifact(t, fmt.Sprintf("%s/charts/hello-world:0.1.0", host), chartContent, helmChartContentMediaType)
+	pushOCIArtifact(t, fmt.Sprintf("%s/images/nginx:1.16.0", host), []byte("not a chart"), types.DockerLayer)
+
+	type args struct {
+		ctx       context.Context
+		reference string
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "success: pull chart layer",
+			args: args{
+				ctx:       context.Background(),
+				reference: fmt.Sprintf("oci://%s/charts/hello-world:0.1.0", host),
+			},
+			want:    chartContent,
+			wantErr: false,
+		},
+		{
+			name: "fail: invalid reference",
+			args: args{
+				ctx:       context.Background(),
+				reference: "oci://registry/charts/hello-world@latest@v1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: chart does not exist",
+			args: args{
+				ctx:       context.Background(),
+				reference: fmt.Sprintf("oci://%s/charts/missing:0.1.0", host),
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: artifact has no chart layer",
+			args: args{
+				ctx:       context.Background(),
+				reference: fmt.Sprintf("oci://%s/images/nginx:1.16.0", host),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, withLoopback())
+
+			chartPath, err := s.pullOCIChart(tt.args.ctx, tt.args.reference)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Service.pullOCIChart() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			defer os.Remove(chartPath)
+
+			got, err := os.ReadFile(chartPath)
+			if err != nil {
+				t.Errorf("failed to read pulled chart: %v", err)
+				return
+			}
+
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Service.pullOCIChart() content = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestService_parseHelmChart(t *testing.T) {
 	type args struct {
 		chartPath string
@@ -163,7 +286,7 @@ func TestService_parseHelmChart(t *testing.T) {
 				t.Errorf("failed to download chart")
 			}
 
-			_, err = s.parseHelmChart(chartPath)
+			_, err = s.parseHelmChart(context.Background(), chartPath, &renderValues{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Service.parseHelmChart() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -174,8 +297,8 @@ func TestService_parseHelmChart(t *testing.T) {
 
 func TestService_ProcessHelmChart(t *testing.T) {
 	type args struct {
-		ctx  context.Context
-		path string
+		ctx   context.Context
+		input *domain.HelmLinkInput
 	}
 
 	tests := []struct {
@@ -186,24 +309,30 @@ func TestService_ProcessHelmChart(t *testing.T) {
 		{
 			name: "success: parse helm chart and extract images",
 			args: args{
-				ctx:  context.Background(),
-				path: "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz",
+				ctx: context.Background(),
+				input: &domain.HelmLinkInput{
+					Path: "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz",
+				},
 			},
 			wantErr: false,
 		},
 		{
 			name: "error: nil context",
 			args: args{
-				ctx:  nil,
-				path: "https://github.com/",
+				ctx: nil,
+				input: &domain.HelmLinkInput{
+					Path: "https://github.com/",
+				},
 			},
 			wantErr: true,
 		},
 		{
 			name: "error: bad url (no helm chart to download)",
 			args: args{
-				ctx:  context.Background(),
-				path: "https://github.com/",
+				ctx: context.Background(),
+				input: &domain.HelmLinkInput{
+					Path: "https://github.com/",
+				},
 			},
 			wantErr: true,
 		},
@@ -215,7 +344,7 @@ func TestService_ProcessHelmChart(t *testing.T) {
 
 			s := NewHelmService(logger)
 
-			_, err := s.ProcessHelmChart(tt.args.ctx, tt.args.path)
+			_, err := s.ProcessHelmChart(tt.args.ctx, tt.args.input)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Service.ProcessHelmChart() error = %v, wantErr %v", err, tt.wantErr)
 				return
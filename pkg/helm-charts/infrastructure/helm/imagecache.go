@@ -0,0 +1,194 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/infrastructure/cache"
+)
+
+const (
+	// imageBucket holds image details keyed by manifest digest and platform. The suffix is
+	// bumped whenever the cached details change shape so stale entries are ignored.
+	imageBucket = "images/v2"
+
+	// tagBucket holds the digest that a tag last resolved to
+	tagBucket = "tags"
+
+	// DefaultTagTTL is how long a tag is trusted to point to the same digest
+	DefaultTagTTL = 5 * time.Minute
+)
+
+// WithImageCache serves image details from c. Details are keyed by manifest digest, which is
+// immutable, while tags are re-resolved to a digest once their resolution is older than tagTTL.
+func WithImageCache(c *cache.Cache, tagTTL time.Duration) Option {
+	return func(s *Service) {
+		s.cache = c
+		s.tagTTL = tagTTL
+	}
+}
+
+// imageCacheKey identifies the details of a manifest as seen with the lookup options.
+func imageCacheKey(digest string, opts *lookupOptions) string {
+	return digest + "|" + opts.key()
+}
+
+// resolveDigest returns the manifest digest of ref, resolving tags through the registry at most
+// once per tag TTL.
+func (s *Service) resolveDigest(ctx context.Context, ref name.Reference) (string, error) {
+	if digest, ok := ref.(name.Digest); ok {
+		return digest.DigestStr(), nil
+	}
+
+	var digest string
+
+	ok, err := s.cache.Get(tagBucket, ref.Name(), &digest)
+	if err != nil {
+		s.logger.Printf("Failed to read cached digest of %s: %v", ref.Name(), err)
+	}
+
+	if ok {
+		return digest, nil
+	}
+
+	desc, err := remote.Head(ref, s.remoteOptions(ctx)...)
+	if err != nil {
+		return "", err
+	}
+
+	digest = desc.Digest.String()
+
+	if err := s.cache.Put(tagBucket, ref.Name(), digest, s.tagTTL); err != nil {
+		s.logger.Printf("Failed to cache digest of %s: %v", ref.Name(), err)
+	}
+
+	return digest, nil
+}
+
+// fetchCachedImageDetails returns the cached details of the manifest ref resolves to, fetching
+// and caching them on a miss. Cache failures are logged and never fail the lookup.
+func (s *Service) fetchCachedImageDetails(
+	ctx context.Context, image string, ref name.Reference, opts *lookupOptions,
+) (*domain.ImageDetails, error) {
+	digest, err := s.resolveDigest(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	key := imageCacheKey(digest, opts)
+
+	details := &domain.ImageDetails{}
+
+	ok, err := s.cache.Get(imageBucket, key, details)
+	if err != nil {
+		s.logger.Printf("Failed to read cached details of %s: %v", image, err)
+	}
+
+	if ok {
+		details.Image = image
+		details.Cache = domain.CacheStatusHit
+
+		return details, nil
+	}
+
+	desc, err := remote.Get(ref.Context().Digest(digest), s.remoteOptions(ctx)...)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err = s.describeImage(image, desc, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cache.Put(imageBucket, key, details, 0); err != nil {
+		s.logger.Printf("Failed to cache details of %s: %v", image, err)
+	}
+
+	details.Cache = domain.CacheStatusMiss
+
+	return details, nil
+}
+
+// PurgeImageCache removes cached image details. With an empty image every entry is removed,
+// otherwise the tag resolution and the details of the digest the image points to, both as
+// written and as rewritten by the mirror rules.
+func (s *Service) PurgeImageCache(_ context.Context, image string) (*domain.CachePurgeResult, error) {
+	if s.cache == nil {
+		return nil, fmt.Errorf("image cache is not enabled")
+	}
+
+	if image == "" {
+		tags, err := s.cache.DeletePrefix(tagBucket, "")
+		if err != nil {
+			return nil, err
+		}
+
+		images, err := s.cache.DeletePrefix(imageBucket, "")
+		if err != nil {
+			return nil, err
+		}
+
+		return &domain.CachePurgeResult{Purged: tags + images}, nil
+	}
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference: %w", err)
+	}
+
+	references := []name.Reference{ref}
+
+	if mirrored, mirror := s.mirrorImage(ref.Name()); mirror != nil {
+		if mirroredRef, err := name.ParseReference(mirrored); err == nil {
+			references = append(references, mirroredRef)
+		}
+	}
+
+	purged := 0
+
+	for _, ref := range references {
+		count, err := s.purgeReference(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		purged += count
+	}
+
+	return &domain.CachePurgeResult{Purged: purged}, nil
+}
+
+// purgeReference removes the cached tag resolution of ref and the details of its digest.
+// A tag whose resolution is no longer cached has nothing left to purge.
+func (s *Service) purgeReference(ref name.Reference) (int, error) {
+	purged := 0
+
+	var digest string
+
+	if d, ok := ref.(name.Digest); ok {
+		digest = d.DigestStr()
+	} else {
+		ok, err := s.cache.Get(tagBucket, ref.Name(), &digest)
+		if err != nil || !ok {
+			return 0, err
+		}
+
+		if err := s.cache.Delete(tagBucket, ref.Name()); err != nil {
+			return 0, err
+		}
+
+		purged++
+	}
+
+	count, err := s.cache.DeletePrefix(imageBucket, digest+"|")
+	if err != nil {
+		return 0, err
+	}
+
+	return purged + count, nil
+}
@@ -0,0 +1,202 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/infrastructure/cache"
+)
+
+// newCountingRegistry starts an in-process registry and counts the manifest requests it serves
+func newCountingRegistry(t *testing.T) (string, *atomic.Int64) {
+	t.Helper()
+
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+
+	requests := &atomic.Int64{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/manifests/") && r.Method != http.MethodPut {
+			requests.Add(1)
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://"), requests
+}
+
+// openTestCache opens a cache that is closed when the test ends
+func openTestCache(t *testing.T) *cache.Cache {
+	t.Helper()
+
+	c, err := cache.Open(filepath.Join(t.TempDir(), "cache.db"), 16)
+	if err != nil {
+		t.Fatalf("cache.Open() error = %v", err)
+	}
+
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestService_fetchImageDetails_cache(t *testing.T) {
+	host, requests := newCountingRegistry(t)
+
+	image := fmt.Sprintf("%s/library/nginx:1.25", host)
+
+	pushRandomImage(t, image, 2)
+
+	logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+	s := NewHelmService(logger, WithImageCache(openTestCache(t), 50*time.Millisecond), withLoopback())
+
+	steps := []struct {
+		name         string
+		wait         time.Duration
+		purge        bool
+		wantCache    domain.CacheStatus
+		wantRequests int64
+	}{
+		{
+			name:         "miss: tag resolved and manifest fetched",
+			wantCache:    domain.CacheStatusMiss,
+			wantRequests: 2,
+		},
+		{
+			name:         "hit: no registry requests",
+			wantCache:    domain.CacheStatusHit,
+			wantRequests: 0,
+		},
+		{
+			name:         "hit: expired tag resolved again",
+			wait:         100 * time.Millisecond,
+			wantCache:    domain.CacheStatusHit,
+			wantRequests: 1,
+		},
+		{
+			name:         "miss: purged",
+			purge:        true,
+			wantCache:    domain.CacheStatusMiss,
+			wantRequests: 2,
+		},
+	}
+
+	var digest string
+
+	for _, step := range steps {
+		time.Sleep(step.wait)
+
+		if step.purge {
+			result, err := s.PurgeImageCache(context.Background(), image)
+			if err != nil || result.Purged != 2 {
+				t.Fatalf("Service.PurgeImageCache() = %+v, %v, want 2 purged", result, err)
+			}
+		}
+
+		requests.Store(0)
+
+		got, err := s.fetchImageDetails(context.Background(), image, &lookupOptions{})
+		if err != nil {
+			t.Fatalf("%s: Service.fetchImageDetails() error = %v", step.name, err)
+		}
+
+		if digest == "" {
+			digest = got.Digest
+		}
+
+		if got.Cache != step.wantCache || requests.Load() != step.wantRequests {
+			t.Errorf("%s: cache = %v with %d requests, want %v with %d",
+				step.name, got.Cache, requests.Load(), step.wantCache, step.wantRequests)
+		}
+
+		if got.Image != image || got.Layers != 2 || got.Digest != digest || !strings.HasPrefix(digest, "sha256:") {
+			t.Errorf("%s: Service.fetchImageDetails() = %+v", step.name, got)
+		}
+	}
+}
+
+func TestService_PurgeImageCache(t *testing.T) {
+	host := newTestRegistry(t)
+
+	images := []string{
+		fmt.Sprintf("%s/library/nginx:1.25", host),
+		fmt.Sprintf("%s/library/redis:7.2", host),
+	}
+
+	for _, image := range images {
+		pushRandomImage(t, image, 1)
+	}
+
+	tests := []struct {
+		name       string
+		noCache    bool
+		image      string
+		wantPurged int
+		wantErr    bool
+	}{
+		{
+			name:       "success: one image",
+			image:      images[0],
+			wantPurged: 2,
+		},
+		{
+			name:       "success: every image",
+			wantPurged: 4,
+		},
+		{
+			name:       "success: image not cached",
+			image:      fmt.Sprintf("%s/library/postgres:16", host),
+			wantPurged: 0,
+		},
+		{
+			name:    "fail: invalid image",
+			image:   "nginx@latest@v1",
+			wantErr: true,
+		},
+		{
+			name:    "fail: cache not enabled",
+			noCache: true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, withLoopback())
+			if !tt.noCache {
+				s = NewHelmService(logger, WithImageCache(openTestCache(t), DefaultTagTTL), withLoopback())
+			}
+
+			for _, image := range images {
+				if _, err := s.fetchImageDetails(context.Background(), image, &lookupOptions{}); err != nil {
+					t.Fatalf("Service.fetchImageDetails() error = %v", err)
+				}
+			}
+
+			got, err := s.PurgeImageCache(context.Background(), tt.image)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Service.PurgeImageCache() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && got.Purged != tt.wantPurged {
+				t.Errorf("Service.PurgeImageCache() = %v, want %v", got.Purged, tt.wantPurged)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+// imageUsage is a unique image and every place in the chart that references it
+type imageUsage struct {
+	image     string
+	reference string
+	sources   []domain.ImageSource
+}
+
+// normalizeImage expands an image reference to its fully qualified form, adding the default
+// registry, repository namespace and tag the same way container runtimes do.
+// References that cannot be parsed are returned unchanged.
+func normalizeImage(image string) string {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return image
+	}
+
+	return ref.Name()
+}
+
+// groupImages collapses references to the same image into a single usage, keeping the order
+// in which images first appear in the chart.
+func groupImages(references []imageReference) []*imageUsage {
+	var usages []*imageUsage
+
+	byReference := map[string]*imageUsage{}
+
+	for _, ref := range references {
+		normalized := normalizeImage(ref.image)
+
+		usage, ok := byReference[normalized]
+		if !ok {
+			usage = &imageUsage{
+				image:     ref.image,
+				reference: normalized,
+			}
+			byReference[normalized] = usage
+			usages = append(usages, usage)
+		}
+
+		usage.sources = append(usage.sources, ref.source)
+	}
+
+	return usages
+}
+
+// classifyImageError maps a registry lookup error to the status reported for the image.
+func classifyImageError(err error) domain.ImageStatus {
+	if errors.Is(err, &name.ErrBadName{}) {
+		return domain.ImageStatusInvalidReference
+	}
+
+	if errors.Is(err, errPlatformNotFound) {
+		return domain.ImageStatusNotFound
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return domain.ImageStatusCanceled
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return domain.ImageStatusTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return domain.ImageStatusTimeout
+	}
+
+	var transportErr *transport.Error
+	if !errors.As(err, &transportErr) {
+		return domain.ImageStatusError
+	}
+
+	for _, diagnostic := range transportErr.Errors {
+		switch diagnostic.Code {
+		case transport.ManifestUnknownErrorCode, transport.NameUnknownErrorCode:
+			return domain.ImageStatusNotFound
+		case transport.UnauthorizedErrorCode, transport.DeniedErrorCode:
+			return domain.ImageStatusUnauthorized
+		case transport.TooManyRequestsErrorCode:
+			return domain.ImageStatusRateLimited
+		}
+	}
+
+	switch transportErr.StatusCode {
+	case http.StatusNotFound:
+		return domain.ImageStatusNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return domain.ImageStatusUnauthorized
+	case http.StatusTooManyRequests:
+		return domain.ImageStatusRateLimited
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return domain.ImageStatusTimeout
+	default:
+		return domain.ImageStatusError
+	}
+}
+
+// lookupImage fetches the details of a unique image, sharing the lookup with the other charts
+// of a batch when there is one, and records where the chart references it.
+func (s *Service) lookupImage(ctx context.Context, usage *imageUsage, opts *lookupOptions) *domain.ImageDetails {
+	details := sharedLookupsFrom(ctx).lookup(ctx, usage, opts, s.fetchUsageDetails)
+
+	details.Image = usage.image
+	details.Reference = usage.reference
+	details.Pinned, details.PinnedReference = pinReference(usage.reference, details.Digest)
+	details.Occurrences = len(usage.sources)
+	details.Sources = usage.sources
+
+	return details
+}
+
+// fetchUsageDetails fetches the details of an image, through its mirror when one is configured,
+// and records the outcome of the lookup.
+func (s *Service) fetchUsageDetails(ctx context.Context, usage *imageUsage, opts *lookupOptions) *domain.ImageDetails {
+	effective, mirror := s.mirrorImage(usage.reference)
+	if mirror == nil {
+		effective = usage.image
+	}
+
+	details, err := s.fetchImageDetails(ctx, effective, opts)
+
+	fallback := false
+
+	if err != nil && mirror != nil && mirror.Fallback {
+		s.logger.Printf("Failed to fetch details for image %s from mirror %s, falling back to upstream: %v", usage.image, effective, err)
+
+		effective, fallback = usage.image, true
+
+		details, err = s.fetchImageDetails(ctx, effective, opts)
+	}
+
+	if err != nil {
+		s.logger.Printf("Failed to fetch details for image %s: %v", usage.image, err)
+
+		details = &domain.ImageDetails{
+			Status: classifyImageError(err),
+			Error:  err.Error(),
+		}
+	} else {
+		details.Status = domain.ImageStatusOK
+	}
+
+	details.EffectiveReference = normalizeImage(effective)
+	details.MirrorFallback = fallback
+
+	return details
+}
+
+// lookupImages looks up the images with at most lookupConcurrency lookups in flight. Once ctx is done,
+// or the lookup timeout elapses, the remaining images are reported as skipped and the results are partial.
+func (s *Service) lookupImages(ctx context.Context, usages []*imageUsage, opts *lookupOptions) ([]*domain.ImageDetails, bool) {
+	if s.lookupTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, s.lookupTimeout)
+		defer cancel()
+	}
+
+	results := make([]*domain.ImageDetails, len(usages))
+
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range min(s.lookupConcurrency, len(usages)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				results[i] = s.lookupImage(ctx, usages[i], opts)
+
+				domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventImageScanned, Image: results[i]})
+			}
+		}()
+	}
+
+dispatch:
+	for i := range usages {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	for i, usage := range usages {
+		if results[i] == nil {
+			results[i] = skippedImage(usage, ctx.Err())
+
+			domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventImageScanned, Image: results[i]})
+		}
+	}
+
+	return results, ctx.Err() != nil
+}
+
+// skippedImage reports an image that was not looked up because the scan ran out of time.
+func skippedImage(usage *imageUsage, err error) *domain.ImageDetails {
+	pinned, _ := pinReference(usage.reference, "")
+
+	return &domain.ImageDetails{
+		Image:       usage.image,
+		Reference:   usage.reference,
+		Pinned:      pinned,
+		Status:      classifyImageError(err),
+		Error:       fmt.Sprintf("lookup skipped: %v", err),
+		Occurrences: len(usage.sources),
+		Sources:     usage.sources,
+	}
+}
+
+// summarize counts the successful and failed image lookups.
+func summarize(images []*domain.ImageDetails) *domain.ScanSummary {
+	summary := &domain.ScanSummary{Total: len(images)}
+
+	for _, image := range images {
+		if image.Status == domain.ImageStatusOK {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+	}
+
+	return summary
+}
@@ -0,0 +1,434 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+// newTestRegistry starts an in-process registry and returns its host
+func newTestRegistry(t *testing.T) string {
+	t.Helper()
+
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// pushRandomImage pushes a random image with the given number of layers to reference
+func pushRandomImage(t *testing.T, reference string, layers int64, opts ...remote.Option) {
+	t.Helper()
+
+	ref, err := name.ParseReference(reference)
+	if err != nil {
+		t.Fatalf("invalid reference %s: %v", reference, err)
+	}
+
+	img, err := random.Image(1024, layers)
+	if err != nil {
+		t.Fatalf("failed to build image: %v", err)
+	}
+
+	if err := remote.Write(ref, img, opts...); err != nil {
+		t.Fatalf("failed to push image: %v", err)
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	tests := []struct {
+		name  string
+		image string
+		want  string
+	}{
+		{
+			name:  "official image without tag",
+			image: "nginx",
+			want:  "index.docker.io/library/nginx:latest",
+		},
+		{
+			name:  "official image with tag",
+			image: "nginx:1.16.0",
+			want:  "index.docker.io/library/nginx:1.16.0",
+		},
+		{
+			name:  "docker hub user image",
+			image: "docker.io/bitnami/redis:7.2",
+			want:  "index.docker.io/bitnami/redis:7.2",
+		},
+		{
+			name:  "other registry",
+			image: "ghcr.io/fluxcd/source-controller:v1.2.0",
+			want:  "ghcr.io/fluxcd/source-controller:v1.2.0",
+		},
+		{
+			name:  "digest reference",
+			image: "quay.io/prometheus/node-exporter@sha256:4cb2b9019f1757be8482419002cb7afe028fdba35d47958829e4cfeaf6246d80",
+			want:  "quay.io/prometheus/node-exporter@sha256:4cb2b9019f1757be8482419002cb7afe028fdba35d47958829e4cfeaf6246d80",
+		},
+		{
+			name:  "invalid reference is kept as written",
+			image: "docker.io/bitnami/redis@latest@v1",
+			want:  "docker.io/bitnami/redis@latest@v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeImage(tt.image); got != tt.want {
+				t.Errorf("normalizeImage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupImages(t *testing.T) {
+	web := domain.ImageSource{Kind: "Deployment", Name: "web", Container: "nginx", ContainerType: domain.ContainerTypeRegular}
+	worker := domain.ImageSource{Kind: "Deployment", Name: "worker", Container: "nginx", ContainerType: domain.ContainerTypeRegular}
+	job := domain.ImageSource{Kind: "Job", Name: "migrate", Container: "wait", ContainerType: domain.ContainerTypeInit}
+
+	references := []imageReference{
+		{image: "nginx:1.16.0", source: web},
+		{image: "busybox", source: job},
+		{image: "docker.io/library/nginx:1.16.0", source: worker},
+		{image: "busybox:latest", source: web},
+	}
+
+	want := []*imageUsage{
+		{
+			image:     "nginx:1.16.0",
+			reference: "index.docker.io/library/nginx:1.16.0",
+			sources:   []domain.ImageSource{web, worker},
+		},
+		{
+			image:     "busybox",
+			reference: "index.docker.io/library/busybox:latest",
+			sources:   []domain.ImageSource{job, web},
+		},
+	}
+
+	if got := groupImages(references); !reflect.DeepEqual(got, want) {
+		t.Errorf("groupImages() = %+v, want %+v", got, want)
+	}
+}
+
+func TestClassifyImageError(t *testing.T) {
+	_, badNameErr := name.ParseReference("docker.io/bitnami/redis@latest@v1")
+
+	tests := []struct {
+		name string
+		err  error
+		want domain.ImageStatus
+	}{
+		{
+			name: "invalid reference",
+			err:  badNameErr,
+			want: domain.ImageStatusInvalidReference,
+		},
+		{
+			name: "manifest unknown",
+			err: &transport.Error{
+				StatusCode: http.StatusNotFound,
+				Errors:     []transport.Diagnostic{{Code: transport.ManifestUnknownErrorCode}},
+			},
+			want: domain.ImageStatusNotFound,
+		},
+		{
+			name: "not found without diagnostics",
+			err:  &transport.Error{StatusCode: http.StatusNotFound},
+			want: domain.ImageStatusNotFound,
+		},
+		{
+			name: "unauthorized",
+			err: &transport.Error{
+				StatusCode: http.StatusUnauthorized,
+				Errors:     []transport.Diagnostic{{Code: transport.UnauthorizedErrorCode}},
+			},
+			want: domain.ImageStatusUnauthorized,
+		},
+		{
+			name: "forbidden",
+			err:  &transport.Error{StatusCode: http.StatusForbidden},
+			want: domain.ImageStatusUnauthorized,
+		},
+		{
+			name: "rate limited",
+			err: fmt.Errorf("fetching manifest: %w", &transport.Error{
+				StatusCode: http.StatusTooManyRequests,
+				Errors:     []transport.Diagnostic{{Code: transport.TooManyRequestsErrorCode}},
+			}),
+			want: domain.ImageStatusRateLimited,
+		},
+		{
+			name: "deadline exceeded",
+			err:  fmt.Errorf("fetching manifest: %w", context.DeadlineExceeded),
+			want: domain.ImageStatusTimeout,
+		},
+		{
+			name: "registry unavailable",
+			err:  &transport.Error{StatusCode: http.StatusServiceUnavailable},
+			want: domain.ImageStatusError,
+		},
+		{
+			name: "unknown error",
+			err:  fmt.Errorf("connection reset by peer"),
+			want: domain.ImageStatusError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyImageError(tt.err); got != tt.want {
+				t.Errorf("classifyImageError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_lookupImage(t *testing.T) {
+	host := newTestRegistry(t)
+
+	pushRandomImage(t, fmt.Sprintf("%s/library/nginx:1.16.0", host), 3)
+
+	source := domain.ImageSource{Kind: "Deployment", Name: "web", Container: "nginx", ContainerType: domain.ContainerTypeRegular}
+
+	tests := []struct {
+		name       string
+		image      string
+		wantStatus domain.ImageStatus
+		wantLayers int
+	}{
+		{
+			name:       "success: image found",
+			image:      fmt.Sprintf("%s/library/nginx:1.16.0", host),
+			wantStatus: domain.ImageStatusOK,
+			wantLayers: 3,
+		},
+		{
+			name:       "fail: image not found",
+			image:      fmt.Sprintf("%s/library/nginx:0.0.0", host),
+			wantStatus: domain.ImageStatusNotFound,
+		},
+		{
+			name:       "fail: invalid reference",
+			image:      "docker.io/bitnami/redis@latest@v1",
+			wantStatus: domain.ImageStatusInvalidReference,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, withLoopback())
+
+			usage := &imageUsage{
+				image:     tt.image,
+				reference: normalizeImage(tt.image),
+				sources:   []domain.ImageSource{source, source},
+			}
+
+			got := s.lookupImage(context.Background(), usage, &lookupOptions{})
+
+			if got.Status != tt.wantStatus {
+				t.Errorf("Service.lookupImage() status = %v, want %v (error: %s)", got.Status, tt.wantStatus, got.Error)
+				return
+			}
+
+			if (got.Error != "") == (tt.wantStatus == domain.ImageStatusOK) {
+				t.Errorf("Service.lookupImage() error = %q for status %v", got.Error, got.Status)
+			}
+
+			if got.Layers != tt.wantLayers || got.Occurrences != 2 || got.Reference != usage.reference {
+				t.Errorf("Service.lookupImage() = %+v", got)
+			}
+		})
+	}
+}
+
+// slowRegistry is an in-process registry that delays manifest requests and tracks how many are in flight
+type slowRegistry struct {
+	host        string
+	inFlight    atomic.Int64
+	maxInFlight atomic.Int64
+}
+
+// newSlowRegistry starts an in-process registry that answers manifest reads after delay,
+// or as soon as the client goes away
+func newSlowRegistry(t *testing.T, delay time.Duration) *slowRegistry {
+	t.Helper()
+
+	slow := &slowRegistry{}
+
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/manifests/") && r.Method != http.MethodPut && r.Header.Get("X-Test-Push") == "" {
+			current := slow.inFlight.Add(1)
+			defer slow.inFlight.Add(-1)
+
+			for {
+				peak := slow.maxInFlight.Load()
+				if current <= peak || slow.maxInFlight.CompareAndSwap(peak, current) {
+					break
+				}
+			}
+
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	slow.host = strings.TrimPrefix(server.URL, "http://")
+
+	return slow
+}
+
+// pushHeader marks the requests made while pushing test images so the slow registry serves them at once
+type pushHeader struct {
+	transport http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (p *pushHeader) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Test-Push", "true")
+
+	return p.transport.RoundTrip(req)
+}
+
+func TestService_lookupImages(t *testing.T) {
+	tests := []struct {
+		name        string
+		images      int
+		concurrency int
+		delay       time.Duration
+		timeout     time.Duration
+		cancel      bool
+		wantPartial bool
+		wantStatus  domain.ImageStatus
+	}{
+		{
+			name:        "success: every image looked up within the pool size",
+			images:      6,
+			concurrency: 2,
+			delay:       10 * time.Millisecond,
+			wantStatus:  domain.ImageStatusOK,
+		},
+		{
+			name:        "fail: lookup timeout returns partial results",
+			images:      6,
+			concurrency: 2,
+			delay:       10 * time.Second,
+			timeout:     100 * time.Millisecond,
+			wantPartial: true,
+			wantStatus:  domain.ImageStatusTimeout,
+		},
+		{
+			name:        "fail: canceled request returns partial results",
+			images:      6,
+			concurrency: 2,
+			delay:       10 * time.Second,
+			cancel:      true,
+			wantPartial: true,
+			wantStatus:  domain.ImageStatusCanceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slow := newSlowRegistry(t, tt.delay)
+
+			var usages []*imageUsage
+
+			for i := range tt.images {
+				image := fmt.Sprintf("%s/library/app%d:1.0.0", slow.host, i)
+
+				pushRandomImage(t, image, 1, remote.WithTransport(&pushHeader{transport: http.DefaultTransport}))
+
+				usages = append(usages, &imageUsage{image: image, reference: normalizeImage(image)})
+			}
+
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, WithLookupConcurrency(tt.concurrency), WithLookupTimeout(tt.timeout), withLoopback())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if tt.cancel {
+				time.AfterFunc(100*time.Millisecond, cancel)
+			}
+
+			var scanned atomic.Int64
+
+			ctx = domain.WithScanEvents(ctx, func(event *domain.ScanEvent) {
+				if event.Type == domain.ScanEventImageScanned && event.Image != nil {
+					scanned.Add(1)
+				}
+			})
+
+			start := time.Now()
+
+			got, partial := s.lookupImages(ctx, usages, &lookupOptions{})
+
+			if scanned.Load() != int64(tt.images) {
+				t.Errorf("Service.lookupImages() emitted %d image events, want %d", scanned.Load(), tt.images)
+			}
+
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Service.lookupImages() took %v, want it to stop at the deadline", elapsed)
+			}
+
+			if partial != tt.wantPartial || len(got) != tt.images {
+				t.Errorf("Service.lookupImages() partial = %v with %d results, want %v with %d", partial, len(got), tt.wantPartial, tt.images)
+			}
+
+			for i, image := range got {
+				if image.Status != tt.wantStatus || image.Reference != usages[i].reference {
+					t.Errorf("Service.lookupImages() image %d = %+v, want status %v", i, image, tt.wantStatus)
+				}
+			}
+
+			if peak := slow.maxInFlight.Load(); peak > int64(tt.concurrency) {
+				t.Errorf("Service.lookupImages() made %d concurrent requests, want at most %d", peak, tt.concurrency)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	images := []*domain.ImageDetails{
+		{Status: domain.ImageStatusOK},
+		{Status: domain.ImageStatusNotFound},
+		{Status: domain.ImageStatusOK},
+		{Status: domain.ImageStatusRateLimited},
+	}
+
+	want := &domain.ScanSummary{Total: 4, Succeeded: 2, Failed: 2}
+
+	if got := summarize(images); *got != *want {
+		t.Errorf("summarize() = %+v, want %+v", got, want)
+	}
+}
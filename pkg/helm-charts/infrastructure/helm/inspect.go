@@ -0,0 +1,118 @@
+package helm
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+// runsAsRoot reports whether a container started with the configured user runs as root.
+// Images that do not set a user run as root.
+func runsAsRoot(user string) bool {
+	name, _, _ := strings.Cut(user, ":")
+
+	return name == "" || name == "root" || name == "0"
+}
+
+// inspectImage adds the runtime configuration of img to details when opts.inspect is set, and the
+// uncompressed size of its layers when opts.uncompressed is set. Measuring uncompressed sizes
+// downloads and decompresses every layer.
+func inspectImage(img v1.Image, details *domain.ImageDetails, opts *lookupOptions) error {
+	if opts.inspect {
+		config, err := imageConfig(img)
+		if err != nil {
+			return fmt.Errorf("failed to read image config: %w", err)
+		}
+
+		details.Config = config
+	}
+
+	if opts.uncompressed {
+		if err := measureLayers(img, details); err != nil {
+			return fmt.Errorf("failed to measure uncompressed layers: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// imageConfig reads the config blob of img and the annotations of its manifest.
+func imageConfig(img v1.Image) (*domain.ImageConfig, error) {
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &domain.ImageConfig{
+		OS:           configFile.OS,
+		Architecture: configFile.Architecture,
+		Variant:      configFile.Variant,
+		Entrypoint:   configFile.Config.Entrypoint,
+		Cmd:          configFile.Config.Cmd,
+		WorkingDir:   configFile.Config.WorkingDir,
+		User:         configFile.Config.User,
+		RunsAsRoot:   runsAsRoot(configFile.Config.User),
+		Labels:       configFile.Config.Labels,
+		Annotations:  manifest.Annotations,
+	}
+
+	if !configFile.Created.IsZero() {
+		created := configFile.Created.UTC()
+		config.Created = &created
+	}
+
+	if len(configFile.Config.ExposedPorts) > 0 {
+		config.ExposedPorts = slices.Sorted(maps.Keys(configFile.Config.ExposedPorts))
+	}
+
+	return config, nil
+}
+
+// measureLayers decompresses every layer of img to record its uncompressed size. The layers are
+// listed in manifest order, so they line up with details.LayerDetails.
+func measureLayers(img v1.Image, details *domain.ImageDetails) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+
+	if len(layers) != len(details.LayerDetails) {
+		return fmt.Errorf("image has %d layers but its manifest lists %d", len(layers), len(details.LayerDetails))
+	}
+
+	details.UncompressedSize = 0
+
+	for i, layer := range layers {
+		size, err := uncompressedSize(layer)
+		if err != nil {
+			return err
+		}
+
+		details.LayerDetails[i].UncompressedSize = size
+		details.UncompressedSize += size
+	}
+
+	return nil
+}
+
+// uncompressedSize streams a layer through its decompressor and counts the bytes.
+func uncompressedSize(layer v1.Layer) (int64, error) {
+	reader, err := layer.Uncompressed()
+	if err != nil {
+		return 0, err
+	}
+
+	defer reader.Close()
+
+	return io.Copy(io.Discard, reader)
+}
@@ -0,0 +1,211 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+// testImageCreated is the creation date of images pushed by pushConfiguredImage
+var testImageCreated = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// pushConfiguredImage pushes a two layer image with a runtime configuration and annotations,
+// wrapped in an annotated index when index is set.
+func pushConfiguredImage(t *testing.T, reference string, index bool) {
+	t.Helper()
+
+	ref, err := name.ParseReference(reference)
+	if err != nil {
+		t.Fatalf("invalid reference %s: %v", reference, err)
+	}
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("failed to build image: %v", err)
+	}
+
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+
+	configFile = configFile.DeepCopy()
+	configFile.OS = "linux"
+	configFile.Architecture = "amd64"
+	configFile.Created = v1.Time{Time: testImageCreated}
+	configFile.Config = v1.Config{
+		Entrypoint:   []string{"/docker-entrypoint.sh"},
+		Cmd:          []string{"nginx", "-g", "daemon off;"},
+		ExposedPorts: map[string]struct{}{"8080/tcp": {}, "443/tcp": {}},
+		User:         "101:101",
+		Labels:       map[string]string{"org.opencontainers.image.source": "https://github.com/example/app"},
+	}
+
+	img, err = mutate.ConfigFile(img, configFile)
+	if err != nil {
+		t.Fatalf("failed to set config: %v", err)
+	}
+
+	img, _ = mutate.Annotations(img, map[string]string{"org.opencontainers.image.revision": "abc123"}).(v1.Image)
+
+	if !index {
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatalf("failed to push image: %v", err)
+		}
+
+		return
+	}
+
+	var idx v1.ImageIndex = empty.Index
+
+	idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+		Add:        img,
+		Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+	})
+
+	idx, _ = mutate.Annotations(idx, map[string]string{
+		"org.opencontainers.image.revision": "overridden",
+		"org.opencontainers.image.version":  "1.0.0",
+	}).(v1.ImageIndex)
+
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatalf("failed to push index: %v", err)
+	}
+}
+
+func TestService_fetchImageDetails_inspect(t *testing.T) {
+	host := newTestRegistry(t)
+
+	image := fmt.Sprintf("%s/library/app:1.0", host)
+	index := fmt.Sprintf("%s/library/app-multiarch:1.0", host)
+
+	pushConfiguredImage(t, image, false)
+	pushConfiguredImage(t, index, true)
+
+	created := testImageCreated
+
+	wantConfig := &domain.ImageConfig{
+		Created:      &created,
+		OS:           "linux",
+		Architecture: "amd64",
+		Entrypoint:   []string{"/docker-entrypoint.sh"},
+		Cmd:          []string{"nginx", "-g", "daemon off;"},
+		ExposedPorts: []string{"443/tcp", "8080/tcp"},
+		User:         "101:101",
+		Labels:       map[string]string{"org.opencontainers.image.source": "https://github.com/example/app"},
+		Annotations:  map[string]string{"org.opencontainers.image.revision": "abc123"},
+	}
+
+	indexConfig := *wantConfig
+	indexConfig.Annotations = map[string]string{
+		"org.opencontainers.image.revision": "abc123",
+		"org.opencontainers.image.version":  "1.0.0",
+	}
+
+	tests := []struct {
+		name             string
+		image            string
+		options          domain.ImageOptions
+		wantConfig       *domain.ImageConfig
+		wantUncompressed bool
+	}{
+		{
+			name:  "success: no inspection by default",
+			image: image,
+		},
+		{
+			name:       "success: config inspected",
+			image:      image,
+			options:    domain.ImageOptions{Inspect: true},
+			wantConfig: wantConfig,
+		},
+		{
+			name:             "success: uncompressed sizes measured",
+			image:            image,
+			options:          domain.ImageOptions{UncompressedSizes: true},
+			wantUncompressed: true,
+		},
+		{
+			name:             "success: index annotations merged",
+			image:            index,
+			options:          domain.ImageOptions{Inspect: true, UncompressedSizes: true},
+			wantConfig:       &indexConfig,
+			wantUncompressed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, withLoopback())
+
+			opts, err := newLookupOptions(&tt.options)
+			if err != nil {
+				t.Fatalf("newLookupOptions() error = %v", err)
+			}
+
+			got, err := s.fetchImageDetails(context.Background(), tt.image, opts)
+			if err != nil {
+				t.Fatalf("Service.fetchImageDetails() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got.Config, tt.wantConfig) {
+				t.Errorf("Service.fetchImageDetails() config = %+v, want %+v", got.Config, tt.wantConfig)
+			}
+
+			if (got.UncompressedSize > 0) != tt.wantUncompressed {
+				t.Errorf("Service.fetchImageDetails() uncompressed size = %d, want measured %v", got.UncompressedSize, tt.wantUncompressed)
+			}
+
+			var layersTotal int64
+
+			for _, layer := range got.LayerDetails {
+				if (layer.UncompressedSize > 0) != tt.wantUncompressed {
+					t.Errorf("Service.fetchImageDetails() layer %s uncompressed size = %d", layer.Digest, layer.UncompressedSize)
+				}
+
+				layersTotal += layer.UncompressedSize
+			}
+
+			if layersTotal != got.UncompressedSize {
+				t.Errorf("Service.fetchImageDetails() uncompressed size = %d, layers sum to %d", got.UncompressedSize, layersTotal)
+			}
+		})
+	}
+}
+
+func TestRunsAsRoot(t *testing.T) {
+	tests := []struct {
+		user string
+		want bool
+	}{
+		{user: "", want: true},
+		{user: "root", want: true},
+		{user: "0", want: true},
+		{user: "0:0", want: true},
+		{user: "root:wheel", want: true},
+		{user: "101", want: false},
+		{user: "nginx:nginx", want: false},
+		{user: "1000:0", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			if got := runsAsRoot(tt.user); got != tt.want {
+				t.Errorf("runsAsRoot(%q) = %v, want %v", tt.user, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package helm
+
+import (
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+// summarizeLayers deduplicates the layers of the images of a chart and lists the layers shared
+// by several images, in the order they first appear. Images that could not be looked up have no
+// layers and are left out.
+func summarizeLayers(images []*domain.ImageDetails) *domain.LayerSummary {
+	summary := &domain.LayerSummary{Shared: []domain.SharedLayer{}}
+
+	var order []string
+
+	layers := map[string]*domain.SharedLayer{}
+
+	for _, image := range images {
+		seen := map[string]bool{}
+
+		for _, layer := range image.LayerDetails {
+			summary.TotalLayers++
+			summary.TotalSize += layer.Size
+
+			if seen[layer.Digest] {
+				continue
+			}
+
+			seen[layer.Digest] = true
+
+			shared, ok := layers[layer.Digest]
+			if !ok {
+				shared = &domain.SharedLayer{Digest: layer.Digest, Size: layer.Size}
+				layers[layer.Digest] = shared
+
+				order = append(order, layer.Digest)
+
+				summary.UniqueLayers++
+				summary.UniqueSize += layer.Size
+			}
+
+			shared.Images = append(shared.Images, image.Reference)
+		}
+	}
+
+	for _, digest := range order {
+		if len(layers[digest].Images) > 1 {
+			summary.Shared = append(summary.Shared, *layers[digest])
+		}
+	}
+
+	return summary
+}
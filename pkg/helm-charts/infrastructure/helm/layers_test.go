@@ -0,0 +1,64 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+func TestSummarizeLayers(t *testing.T) {
+	base := domain.ImageLayer{Digest: "sha256:base", Size: 100}
+	runtime := domain.ImageLayer{Digest: "sha256:runtime", Size: 50}
+
+	tests := []struct {
+		name   string
+		images []*domain.ImageDetails
+		want   *domain.LayerSummary
+	}{
+		{
+			name: "success: shared layers counted once",
+			images: []*domain.ImageDetails{
+				{Reference: "example.com/api:1", LayerDetails: []domain.ImageLayer{base, runtime, {Digest: "sha256:api", Size: 10}}},
+				{Reference: "example.com/worker:1", LayerDetails: []domain.ImageLayer{base, runtime, {Digest: "sha256:worker", Size: 20}}},
+				{Reference: "example.com/migrate:1", LayerDetails: []domain.ImageLayer{base, {Digest: "sha256:migrate", Size: 5}}},
+				{Reference: "example.com/missing:1", Status: domain.ImageStatusNotFound},
+			},
+			want: &domain.LayerSummary{
+				TotalLayers:  8,
+				UniqueLayers: 5,
+				TotalSize:    435,
+				UniqueSize:   185,
+				Shared: []domain.SharedLayer{
+					{Digest: "sha256:base", Size: 100, Images: []string{"example.com/api:1", "example.com/worker:1", "example.com/migrate:1"}},
+					{Digest: "sha256:runtime", Size: 50, Images: []string{"example.com/api:1", "example.com/worker:1"}},
+				},
+			},
+		},
+		{
+			name: "success: layer repeated within an image is not shared",
+			images: []*domain.ImageDetails{
+				{Reference: "example.com/api:1", LayerDetails: []domain.ImageLayer{base, base}},
+			},
+			want: &domain.LayerSummary{
+				TotalLayers:  2,
+				UniqueLayers: 1,
+				TotalSize:    200,
+				UniqueSize:   100,
+				Shared:       []domain.SharedLayer{},
+			},
+		},
+		{
+			name: "success: no images",
+			want: &domain.LayerSummary{Shared: []domain.SharedLayer{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarizeLayers(tt.images); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("summarizeLayers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
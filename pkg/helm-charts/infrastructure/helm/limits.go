@@ -0,0 +1,231 @@
+package helm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMaxArchiveSize is the largest chart archive or values file downloaded or saved, in bytes
+	DefaultMaxArchiveSize = 20 << 20
+
+	// DefaultMaxDecompressedSize is the most bytes a chart archive, including its packaged subcharts, may decompress to
+	DefaultMaxDecompressedSize = 100 << 20
+
+	// DefaultMaxIndexSize is the largest repository index downloaded, in bytes
+	DefaultMaxIndexSize = 50 << 20
+
+	// DefaultMaxArchiveFiles is the most entries a chart archive, including its packaged subcharts, may contain
+	DefaultMaxArchiveFiles = 5000
+
+	// DefaultDownloadTimeout bounds downloads of charts, repository indexes and values files
+	DefaultDownloadTimeout = time.Minute
+)
+
+var (
+	errArchiveTooLarge      = errors.New("chart archive exceeds the maximum size")
+	errIndexTooLarge        = errors.New("repository index exceeds the maximum size")
+	errDecompressedTooLarge = errors.New("chart archive exceeds the maximum decompressed size")
+	errTooManyFiles         = errors.New("chart archive contains too many files")
+	errUnsafeEntry          = errors.New("chart archive entry escapes the chart root")
+)
+
+// ArchiveLimits bounds the chart archives a Service accepts. Zero values fall back to the defaults.
+type ArchiveLimits struct {
+	MaxArchiveSize      int64
+	MaxDecompressedSize int64
+	MaxFiles            int
+	MaxIndexSize        int64
+}
+
+// WithArchiveLimits bounds the size of chart archives and values files, the size chart archives
+// decompress to, the number of files they contain and the size of repository indexes.
+func WithArchiveLimits(limits ArchiveLimits) Option {
+	return func(s *Service) {
+		if limits.MaxArchiveSize > 0 {
+			s.limits.MaxArchiveSize = limits.MaxArchiveSize
+		}
+
+		if limits.MaxDecompressedSize > 0 {
+			s.limits.MaxDecompressedSize = limits.MaxDecompressedSize
+		}
+
+		if limits.MaxFiles > 0 {
+			s.limits.MaxFiles = limits.MaxFiles
+		}
+
+		if limits.MaxIndexSize > 0 {
+			s.limits.MaxIndexSize = limits.MaxIndexSize
+		}
+	}
+}
+
+// WithDownloadTimeout bounds downloads of charts, repository indexes and values files, and OCI chart pulls.
+// Zero disables the timeout.
+func WithDownloadTimeout(timeout time.Duration) Option {
+	return func(s *Service) {
+		s.downloadTimeout = timeout
+	}
+}
+
+// readAllLimited reads r to the end, failing with tooLarge beyond limit bytes.
+func readAllLimited(r io.Reader, limit int64, tooLarge error) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%w of %d bytes", tooLarge, limit)
+	}
+
+	return content, nil
+}
+
+// archiveChecker walks a chart archive and its packaged subcharts, enforcing the limits across all of them.
+// The decompressed size counts the output of every gzip stream, so a packaged subchart counts both
+// as a file of its parent and with its own contents.
+type archiveChecker struct {
+	limits       ArchiveLimits
+	files        int
+	decompressed int64
+}
+
+// decompressedReader counts the bytes read from a gzip stream towards the decompressed size.
+type decompressedReader struct {
+	r       io.Reader
+	checker *archiveChecker
+}
+
+func (d *decompressedReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+
+	d.checker.decompressed += int64(n)
+	if d.checker.decompressed > d.checker.limits.MaxDecompressedSize {
+		return n, errDecompressedTooLarge
+	}
+
+	return n, err
+}
+
+// validateChartArchive checks that the chart archive at chartPath stays within the limits and that
+// none of its entries, or links, point outside the chart root.
+func (s *Service) validateChartArchive(chartPath string) error {
+	file, err := os.Open(chartPath)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	checker := &archiveChecker{limits: s.limits}
+
+	return checker.check(file)
+}
+
+// check walks one gzipped tar stream, descending into packaged subcharts.
+func (c *archiveChecker) check(archive io.Reader) error {
+	gzipReader, err := gzip.NewReader(archive)
+	if err != nil {
+		return fmt.Errorf("invalid chart archive: %w", err)
+	}
+
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(&decompressedReader{r: gzipReader, checker: c})
+
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return c.readError(err)
+		}
+
+		c.files++
+		if c.files > c.limits.MaxFiles {
+			return fmt.Errorf("%w: more than %d files", errTooManyFiles, c.limits.MaxFiles)
+		}
+
+		if err := checkEntry(header); err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeReg && isPackagedSubchart(header.Name) {
+			if err := c.check(tarReader); err != nil {
+				return fmt.Errorf("invalid subchart %s: %w", header.Name, err)
+			}
+		}
+	}
+}
+
+// readError reports the decompressed size limit when it was hit, whichever way the readers wrapped it.
+func (c *archiveChecker) readError(err error) error {
+	if c.decompressed > c.limits.MaxDecompressedSize {
+		return fmt.Errorf("%w of %d bytes", errDecompressedTooLarge, c.limits.MaxDecompressedSize)
+	}
+
+	return fmt.Errorf("invalid chart archive: %w", err)
+}
+
+// isPackagedSubchart reports whether a tar entry is a packaged chart in the charts directory of a chart.
+func isPackagedSubchart(entryName string) bool {
+	parts := strings.Split(path.Clean(entryName), "/")
+
+	return len(parts) == 3 && parts[1] == "charts" && strings.HasSuffix(parts[2], ".tgz")
+}
+
+// checkEntry rejects entries whose name, or link target, lies outside the top level chart directory.
+func checkEntry(header *tar.Header) error {
+	root, ok := entryRoot(header.Name)
+	if !ok {
+		return fmt.Errorf("%w: %s", errUnsafeEntry, header.Name)
+	}
+
+	var target string
+
+	switch header.Typeflag {
+	case tar.TypeSymlink:
+		if path.IsAbs(header.Linkname) {
+			return fmt.Errorf("%w: %s links to %s", errUnsafeEntry, header.Name, header.Linkname)
+		}
+
+		target = path.Join(path.Dir(path.Clean(header.Name)), header.Linkname) //nolint:gosec // only compared, nothing is extracted
+	case tar.TypeLink:
+		target = header.Linkname
+	default:
+		return nil
+	}
+
+	if linkRoot, ok := entryRoot(target); !ok || linkRoot != root {
+		return fmt.Errorf("%w: %s links to %s", errUnsafeEntry, header.Name, header.Linkname)
+	}
+
+	return nil
+}
+
+// entryRoot returns the top level directory of a relative archive path, and false for absolute
+// paths and paths leaving the archive.
+func entryRoot(entryName string) (string, bool) {
+	if entryName == "" || path.IsAbs(entryName) {
+		return "", false
+	}
+
+	cleaned := path.Clean(entryName)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", false
+	}
+
+	root, _, _ := strings.Cut(cleaned, "/")
+
+	return root, true
+}
@@ -0,0 +1,317 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+)
+
+// tarEntry is an entry of an archive built by buildTarArchive
+type tarEntry struct {
+	header  tar.Header
+	content string
+}
+
+// regularEntry returns a regular file entry
+func regularEntry(name, content string) tarEntry {
+	return tarEntry{header: tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}, content: content}
+}
+
+// linkEntry returns a symbolic or hard link entry
+func linkEntry(name, target string, typeflag byte) tarEntry {
+	return tarEntry{header: tar.Header{Name: name, Mode: 0o777, Linkname: target, Typeflag: typeflag}}
+}
+
+// buildTarArchive builds a gzipped tar archive holding entries in order, unlike buildChartArchive
+// which only writes regular files.
+func buildTarArchive(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	gzipWriter, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		t.Fatalf("failed to create gzip writer: %v", err)
+	}
+
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, entry := range entries {
+		if err := tarWriter.WriteHeader(&entry.header); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+
+		if _, err := tarWriter.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("failed to write tar entry: %v", err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// emptyTempDir points temporary files at a fresh directory and returns it
+func emptyTempDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	return dir
+}
+
+// assertEmptyDir fails the test when files were left behind in dir
+func assertEmptyDir(t *testing.T, dir string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", dir, err)
+	}
+
+	for _, entry := range entries {
+		t.Errorf("temporary file %s was not removed", entry.Name())
+	}
+}
+
+func TestService_validateChartArchive(t *testing.T) {
+	bomb := strings.Repeat("\x00", 4<<20)
+
+	chart := regularEntry("app/Chart.yaml", testChartYAML)
+
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		wantErr error
+	}{
+		{
+			name:    "success: chart",
+			entries: []tarEntry{chart, regularEntry("app/values.yaml", "image: nginx:1.16\n")},
+		},
+		{
+			name: "success: links inside the chart",
+			entries: []tarEntry{
+				chart,
+				regularEntry("app/files/config.yaml", "key: value\n"),
+				linkEntry("app/templates/config.yaml", "../files/config.yaml", tar.TypeSymlink),
+				linkEntry("app/files/copy.yaml", "app/files/config.yaml", tar.TypeLink),
+			},
+		},
+		{
+			name: "success: packaged subchart",
+			entries: []tarEntry{chart, regularEntry("app/charts/redis.tgz", string(buildTarArchive(t,
+				regularEntry("redis/Chart.yaml", "name: redis\nversion: 1.0.0\n"),
+				linkEntry("redis/templates/link.yaml", "../values.yaml", tar.TypeSymlink),
+			)))},
+		},
+		{
+			name:    "fail: gzip bomb",
+			entries: []tarEntry{chart, regularEntry("app/files/zeros", bomb)},
+			wantErr: errDecompressedTooLarge,
+		},
+		{
+			name: "fail: gzip bomb in packaged subchart",
+			entries: []tarEntry{chart, regularEntry("app/charts/redis.tgz", string(buildTarArchive(t,
+				regularEntry("redis/Chart.yaml", "name: redis\nversion: 1.0.0\n"),
+				regularEntry("redis/files/zeros", bomb),
+			)))},
+			wantErr: errDecompressedTooLarge,
+		},
+		{
+			name: "fail: too many files",
+			entries: []tarEntry{
+				chart,
+				regularEntry("app/templates/a.yaml", ""),
+				regularEntry("app/templates/b.yaml", ""),
+				regularEntry("app/templates/c.yaml", ""),
+				regularEntry("app/templates/d.yaml", ""),
+			},
+			wantErr: errTooManyFiles,
+		},
+		{
+			name:    "fail: parent directory entry",
+			entries: []tarEntry{chart, regularEntry("../evil.sh", "#!/bin/sh\n")},
+			wantErr: errUnsafeEntry,
+		},
+		{
+			name:    "fail: entry escaping after cleaning",
+			entries: []tarEntry{chart, regularEntry("app/templates/../../../evil.sh", "#!/bin/sh\n")},
+			wantErr: errUnsafeEntry,
+		},
+		{
+			name:    "fail: absolute entry",
+			entries: []tarEntry{chart, regularEntry("/etc/cron.d/evil", "* * * * * root sh\n")},
+			wantErr: errUnsafeEntry,
+		},
+		{
+			name:    "fail: symlink escaping the chart",
+			entries: []tarEntry{chart, linkEntry("app/templates/secret.yaml", "../../../etc/shadow", tar.TypeSymlink)},
+			wantErr: errUnsafeEntry,
+		},
+		{
+			name:    "fail: absolute symlink",
+			entries: []tarEntry{chart, linkEntry("app/templates/secret.yaml", "/etc/shadow", tar.TypeSymlink)},
+			wantErr: errUnsafeEntry,
+		},
+		{
+			name:    "fail: symlink into another chart root",
+			entries: []tarEntry{chart, linkEntry("app/templates/other.yaml", "../../other/values.yaml", tar.TypeSymlink)},
+			wantErr: errUnsafeEntry,
+		},
+		{
+			name:    "fail: hard link escaping the chart",
+			entries: []tarEntry{chart, linkEntry("app/templates/passwd", "../etc/passwd", tar.TypeLink)},
+			wantErr: errUnsafeEntry,
+		},
+		{
+			name: "fail: symlink escaping a packaged subchart",
+			entries: []tarEntry{chart, regularEntry("app/charts/redis.tgz", string(buildTarArchive(t,
+				regularEntry("redis/Chart.yaml", "name: redis\nversion: 1.0.0\n"),
+				linkEntry("redis/templates/secret.yaml", "../../app/values.yaml", tar.TypeSymlink),
+			)))},
+			wantErr: errUnsafeEntry,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, WithArchiveLimits(ArchiveLimits{MaxDecompressedSize: 1 << 20, MaxFiles: 4}))
+
+			err := s.validateChartArchive(writeChartArchive(t, buildTarArchive(t, tt.entries...)))
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("Service.validateChartArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_ProcessHelmChartArchive_limits(t *testing.T) {
+	bomb := buildTarArchive(t, regularEntry("app/Chart.yaml", testChartYAML), regularEntry("app/zeros", strings.Repeat("\x00", 4<<20)))
+	traversal := buildTarArchive(t, regularEntry("app/Chart.yaml", testChartYAML), regularEntry("app/../../evil.sh", "#!/bin/sh\n"))
+
+	tests := []struct {
+		name    string
+		archive []byte
+		wantErr error
+	}{
+		{
+			name:    "fail: archive too large",
+			archive: bytes.Repeat([]byte{0x1f}, 2<<20),
+			wantErr: errArchiveTooLarge,
+		},
+		{
+			name:    "fail: gzip bomb",
+			archive: bomb,
+			wantErr: errDecompressedTooLarge,
+		},
+		{
+			name:    "fail: path traversal",
+			archive: traversal,
+			wantErr: errUnsafeEntry,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := emptyTempDir(t)
+
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, WithArchiveLimits(ArchiveLimits{MaxArchiveSize: 1 << 20, MaxDecompressedSize: 1 << 20}))
+
+			_, err := s.ProcessHelmChartArchive(context.Background(), bytes.NewReader(tt.archive))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Service.ProcessHelmChartArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			assertEmptyDir(t, tempDir)
+		})
+	}
+}
+
+func TestService_downloadHelmChart_limits(t *testing.T) {
+	const chartURL = "https://charts.bitnami.com/bitnami/redis-20.6.1.tgz"
+
+	tempDir := emptyTempDir(t)
+
+	logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+	s := NewHelmService(logger, WithArchiveLimits(ArchiveLimits{MaxArchiveSize: 1024}))
+
+	httpmock.ActivateNonDefault(s.httpClient)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodGet, chartURL, httpmock.NewBytesResponder(http.StatusOK, make([]byte, 4096)))
+
+	_, err := s.downloadHelmChart(context.Background(), chartURL)
+	if !errors.Is(err, errArchiveTooLarge) {
+		t.Errorf("Service.downloadHelmChart() error = %v, wantErr %v", err, errArchiveTooLarge)
+	}
+
+	assertEmptyDir(t, tempDir)
+
+	s = NewHelmService(logger, WithArchiveLimits(ArchiveLimits{MaxArchiveSize: 1024}), WithChartCache(openTestCache(t), DefaultChartCacheTTL, DefaultChartCacheMaxSize))
+
+	httpmock.ActivateNonDefault(s.httpClient)
+
+	_, _, err = s.downloadCachedChart(context.Background(), chartURL)
+	if !errors.Is(err, errArchiveTooLarge) {
+		t.Errorf("Service.downloadCachedChart() error = %v, wantErr %v", err, errArchiveTooLarge)
+	}
+}
+
+func TestService_fetchRepositoryIndex_limits(t *testing.T) {
+	const repoURL = "https://charts.bitnami.com/bitnami"
+
+	tests := []struct {
+		name    string
+		index   string
+		wantErr error
+	}{
+		{
+			name:  "success: index within the limit",
+			index: testRepositoryIndex,
+		},
+		{
+			name:    "fail: index beyond the limit",
+			index:   testRepositoryIndex + strings.Repeat("# padding\n", 1024),
+			wantErr: errIndexTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, WithArchiveLimits(ArchiveLimits{MaxIndexSize: int64(len(testRepositoryIndex))}))
+
+			httpmock.ActivateNonDefault(s.httpClient)
+			defer httpmock.DeactivateAndReset()
+
+			httpmock.RegisterResponder(http.MethodGet, repoURL+"/index.yaml", httpmock.NewStringResponder(http.StatusOK, tt.index))
+
+			_, err := s.fetchRepositoryIndex(context.Background(), repoURL)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Service.fetchRepositoryIndex() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
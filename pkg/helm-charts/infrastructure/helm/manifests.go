@@ -0,0 +1,245 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// sourceCommentPrefix starts the comment helm writes above every rendered document
+const sourceCommentPrefix = "# Source: "
+
+// imageReference is an image found in the rendered manifests together with where it was found
+type imageReference struct {
+	image  string
+	source domain.ImageSource
+}
+
+// container is a container entry of a pod spec
+type container struct {
+	Name  string `yaml:"name"`
+	Image string `yaml:"image"`
+}
+
+// podSpec holds the containers of a Kubernetes pod spec
+type podSpec struct {
+	Containers          []container `yaml:"containers"`
+	InitContainers      []container `yaml:"initContainers"`
+	EphemeralContainers []container `yaml:"ephemeralContainers"`
+}
+
+// podTemplate is the pod template embedded in workload resources
+type podTemplate struct {
+	Spec podSpec `yaml:"spec"`
+}
+
+// objectHeader identifies a rendered Kubernetes object
+type objectHeader struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+}
+
+// podObject is a Pod
+type podObject struct {
+	Spec podSpec `yaml:"spec"`
+}
+
+// workloadObject is a resource managing pods through a pod template
+type workloadObject struct {
+	Spec struct {
+		Template podTemplate `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+// cronJobObject is a CronJob, whose pod template is nested in its job template
+type cronJobObject struct {
+	Spec struct {
+		JobTemplate struct {
+			Spec struct {
+				Template podTemplate `yaml:"template"`
+			} `yaml:"spec"`
+		} `yaml:"jobTemplate"`
+	} `yaml:"spec"`
+}
+
+// listObject is a v1 List wrapping other objects
+type listObject struct {
+	Items []yaml.Node `yaml:"items"`
+}
+
+// workloadKinds are the kinds that embed a pod template under spec.template
+var workloadKinds = map[string]bool{
+	"Deployment":            true,
+	"StatefulSet":           true,
+	"DaemonSet":             true,
+	"ReplicaSet":            true,
+	"ReplicationController": true,
+	"Job":                   true,
+}
+
+// images returns the images of every container in the pod spec, attributed to the object owning it.
+func (p *podSpec) images(template string, header *objectHeader) []imageReference {
+	var images []imageReference
+
+	containerLists := []struct {
+		containerType domain.ContainerType
+		containers    []container
+	}{
+		{domain.ContainerTypeInit, p.InitContainers},
+		{domain.ContainerTypeRegular, p.Containers},
+		{domain.ContainerTypeEphemeral, p.EphemeralContainers},
+	}
+
+	for _, list := range containerLists {
+		for _, c := range list.containers {
+			image := strings.TrimSpace(c.Image)
+			if image == "" {
+				continue
+			}
+
+			images = append(images, imageReference{
+				image: image,
+				source: domain.ImageSource{
+					Template:      template,
+					Kind:          header.Kind,
+					Namespace:     header.Metadata.Namespace,
+					Name:          header.Metadata.Name,
+					Container:     c.Name,
+					ContainerType: list.containerType,
+				},
+			})
+		}
+	}
+
+	return images
+}
+
+// objectPodSpec returns the pod spec of a rendered object, or nil if the object does not run pods.
+func objectPodSpec(header *objectHeader, node *yaml.Node) (*podSpec, error) {
+	switch {
+	case header.Kind == "Pod":
+		pod := &podObject{}
+		if err := node.Decode(pod); err != nil {
+			return nil, err
+		}
+
+		return &pod.Spec, nil
+	case header.Kind == "CronJob":
+		cronJob := &cronJobObject{}
+		if err := node.Decode(cronJob); err != nil {
+			return nil, err
+		}
+
+		return &cronJob.Spec.JobTemplate.Spec.Template.Spec, nil
+	case workloadKinds[header.Kind]:
+		workload := &workloadObject{}
+		if err := node.Decode(workload); err != nil {
+			return nil, err
+		}
+
+		return &workload.Spec.Template.Spec, nil
+	default:
+		return nil, nil
+	}
+}
+
+// isListKind reports whether kind is a list of objects that may run pods.
+func isListKind(kind string) bool {
+	item, ok := strings.CutSuffix(kind, "List")
+	if !ok {
+		return false
+	}
+
+	return item == "" || item == "Pod" || item == "CronJob" || workloadKinds[item]
+}
+
+// isMapping reports whether the node, or the content of a document node, is a mapping.
+func isMapping(node *yaml.Node) bool {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	return node.Kind == yaml.MappingNode
+}
+
+// objectImages returns the images used by a rendered object, descending into lists.
+func objectImages(template string, node *yaml.Node) ([]imageReference, error) {
+	if !isMapping(node) {
+		return nil, nil
+	}
+
+	header := &objectHeader{}
+	if err := node.Decode(header); err != nil {
+		return nil, fmt.Errorf("invalid object: %w", err)
+	}
+
+	if isListKind(header.Kind) {
+		list := &listObject{}
+		if err := node.Decode(list); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", header.Kind, err)
+		}
+
+		var images []imageReference
+
+		for i := range list.Items {
+			itemImages, err := objectImages(template, &list.Items[i])
+			if err != nil {
+				return nil, err
+			}
+
+			images = append(images, itemImages...)
+		}
+
+		return images, nil
+	}
+
+	spec, err := objectPodSpec(header, node)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", header.Kind, header.Metadata.Name, err)
+	}
+
+	if spec == nil {
+		return nil, nil
+	}
+
+	return spec.images(template, header), nil
+}
+
+// extractImages parses the rendered templates and returns the image of every container declared
+// in the pod specs of the workloads they contain, attributed to the template declaring it.
+func extractImages(templates []renderedTemplate) ([]imageReference, error) {
+	var images []imageReference
+
+	for _, template := range templates {
+		decoder := yaml.NewDecoder(strings.NewReader(template.Manifest))
+
+		for {
+			document := &yaml.Node{}
+
+			err := decoder.Decode(document)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse rendered manifests: %w", err)
+			}
+
+			objImages, err := objectImages(template.Name, document)
+			if err != nil {
+				return nil, err
+			}
+
+			images = append(images, objImages...)
+		}
+	}
+
+	return images, nil
+}
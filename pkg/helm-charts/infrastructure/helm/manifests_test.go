@@ -0,0 +1,347 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+// referencedImages returns just the image names of the references
+func referencedImages(references []imageReference) []string {
+	var images []string
+
+	for _, reference := range references {
+		images = append(images, reference.image)
+	}
+
+	return images
+}
+
+func TestExtractImages(t *testing.T) {
+	tests := []struct {
+		name     string
+		rendered string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name: "success: deployment with comments, annotations and configmap data",
+			rendered: `---
+# Source: hello-world/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: hello-world
+data:
+  values.yaml: |
+    image: busybox:1.36
+---
+# Source: hello-world/templates/deployment.yaml
+# image: commented/out:1.0
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: hello-world
+  annotations:
+    image: annotated/image:1.0
+spec:
+  template:
+    spec:
+      containers:
+        - name: hello-world
+          image: "nginx:1.16.0"
+          env:
+            - name: image
+              value: "image: env/value:1.0"
+`,
+			want:    []string{"nginx:1.16.0"},
+			wantErr: false,
+		},
+		{
+			name: "success: folded block scalar and flow style",
+			rendered: `apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  template:
+    spec:
+      containers:
+        - name: db
+          image: >-
+            docker.io/bitnami/postgresql:16.1.0
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata: {name: agent}
+spec: {template: {spec: {containers: [{name: agent, image: "fluent/fluent-bit:3.0"}]}}}
+`,
+			want:    []string{"docker.io/bitnami/postgresql:16.1.0", "fluent/fluent-bit:3.0"},
+			wantErr: false,
+		},
+		{
+			name: "success: init, regular and ephemeral containers",
+			rendered: `apiVersion: v1
+kind: Pod
+metadata:
+  name: debug
+spec:
+  initContainers:
+    - name: init
+      image: busybox:1.36
+  containers:
+    - name: app
+      image: nginx:1.25
+  ephemeralContainers:
+    - name: debugger
+      image: nicolaka/netshoot:latest
+`,
+			want:    []string{"busybox:1.36", "nginx:1.25", "nicolaka/netshoot:latest"},
+			wantErr: false,
+		},
+		{
+			name: "success: cronjob, job, replicaset and replicationcontroller",
+			rendered: `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  schedule: "@daily"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: backup
+              image: restic/restic:0.16.0
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      containers:
+        - name: migrate
+          image: migrate/migrate:v4
+---
+apiVersion: apps/v1
+kind: ReplicaSet
+metadata:
+  name: rs
+spec:
+  template:
+    spec:
+      containers:
+        - name: rs
+          image: redis:7
+---
+apiVersion: v1
+kind: ReplicationController
+metadata:
+  name: rc
+spec:
+  template:
+    spec:
+      containers:
+        - name: rc
+          image: memcached:1.6
+`,
+			want:    []string{"restic/restic:0.16.0", "migrate/migrate:v4", "redis:7", "memcached:1.6"},
+			wantErr: false,
+		},
+		{
+			name: "success: list of workloads",
+			rendered: `apiVersion: v1
+kind: List
+items:
+  - apiVersion: apps/v1
+    kind: Deployment
+    metadata:
+      name: web
+    spec:
+      template:
+        spec:
+          containers:
+            - name: web
+              image: nginx:1.25
+  - apiVersion: v1
+    kind: Service
+    metadata:
+      name: web
+`,
+			want:    []string{"nginx:1.25"},
+			wantErr: false,
+		},
+		{
+			name: "success: custom resources and empty documents are ignored",
+			rendered: `---
+# Source: operator/templates/empty.yaml
+---
+apiVersion: example.com/v1
+kind: Database
+metadata:
+  name: db
+spec:
+  containers: "not a list"
+  image: postgres:16
+---
+just a scalar
+---
+- a
+- sequence
+`,
+			want:    nil,
+			wantErr: false,
+		},
+		{
+			name: "success: containers without image are skipped",
+			rendered: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+        - name: sidecar
+          image: "  envoyproxy/envoy:v1.29.0  "
+`,
+			want:    []string{"envoyproxy/envoy:v1.29.0"},
+			wantErr: false,
+		},
+		{
+			name:     "fail: malformed yaml",
+			rendered: "kind: Deployment\nspec: [unclosed\n",
+			wantErr:  true,
+		},
+		{
+			name: "fail: malformed pod spec",
+			rendered: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers: "nginx:1.25"
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractImages(splitManifest(tt.rendered))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("extractImages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if images := referencedImages(got); !reflect.DeepEqual(images, tt.want) {
+				t.Errorf("extractImages() = %v, want %v", images, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractImages_sources(t *testing.T) {
+	rendered := `---
+# Source: hello-world/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: hello-world
+  namespace: web
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: wait
+          image: busybox:1.36
+      containers:
+        - name: hello-world
+          image: nginx:1.16.0
+---
+# Source: hello-world/charts/debug/templates/pods.yaml
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: Pod
+    metadata:
+      name: debug
+    spec:
+      ephemeralContainers:
+        - name: debugger
+          image: nicolaka/netshoot:latest
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      containers:
+        - name: migrate
+          image: migrate/migrate:v4
+`
+
+	want := []imageReference{
+		{
+			image: "busybox:1.36",
+			source: domain.ImageSource{
+				Template:      "hello-world/templates/deployment.yaml",
+				Kind:          "Deployment",
+				Namespace:     "web",
+				Name:          "hello-world",
+				Container:     "wait",
+				ContainerType: domain.ContainerTypeInit,
+			},
+		},
+		{
+			image: "nginx:1.16.0",
+			source: domain.ImageSource{
+				Template:      "hello-world/templates/deployment.yaml",
+				Kind:          "Deployment",
+				Namespace:     "web",
+				Name:          "hello-world",
+				Container:     "hello-world",
+				ContainerType: domain.ContainerTypeRegular,
+			},
+		},
+		{
+			image: "nicolaka/netshoot:latest",
+			source: domain.ImageSource{
+				Template:      "hello-world/charts/debug/templates/pods.yaml",
+				Kind:          "Pod",
+				Name:          "debug",
+				Container:     "debugger",
+				ContainerType: domain.ContainerTypeEphemeral,
+			},
+		},
+		{
+			image: "migrate/migrate:v4",
+			source: domain.ImageSource{
+				Kind:          "Job",
+				Name:          "migrate",
+				Container:     "migrate",
+				ContainerType: domain.ContainerTypeRegular,
+			},
+		},
+	}
+
+	got, err := extractImages(splitManifest(rendered))
+	if err != nil {
+		t.Errorf("extractImages() error = %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extractImages() = %+v, want %+v", got, want)
+	}
+}
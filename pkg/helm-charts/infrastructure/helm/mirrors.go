@@ -0,0 +1,96 @@
+package helm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// MirrorRule rewrites image references before their details are looked up, so images are sized
+// as pulled through a mirror or pull-through cache. Rules match the fully qualified reference, such
+// as index.docker.io/library/nginx:1.25, either by Prefix or by Regex. A Prefix is replaced by
+// Replacement; a Regex is replaced using regexp expansion, so Replacement may refer to groups as $1.
+// With Fallback set, images that cannot be looked up through the mirror are looked up upstream.
+type MirrorRule struct {
+	Prefix      string `yaml:"prefix"`
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"`
+	Fallback    bool   `yaml:"fallback"`
+
+	pattern *regexp.Regexp
+}
+
+// compile validates the rule and prepares it for matching. A trailing * on the prefix and the
+// replacement is accepted for readability, as in docker.io/* -> harbor.internal/dockerhub/*.
+func (m *MirrorRule) compile() error {
+	if (m.Prefix == "") == (m.Regex == "") {
+		return fmt.Errorf("exactly one of prefix or regex is required")
+	}
+
+	if m.Replacement == "" {
+		return fmt.Errorf("replacement is required")
+	}
+
+	if m.Regex != "" {
+		pattern, err := regexp.Compile(m.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+
+		m.pattern = pattern
+
+		return nil
+	}
+
+	m.Prefix = normalizePrefix(strings.TrimSuffix(m.Prefix, "*"))
+	m.Replacement = strings.TrimSuffix(m.Replacement, "*")
+
+	return nil
+}
+
+// normalizePrefix expands the registry of a prefix the way references are normalized,
+// so docker.io/ matches index.docker.io/ references.
+func normalizePrefix(prefix string) string {
+	host, rest, ok := strings.Cut(prefix, "/")
+	if !ok {
+		return prefix
+	}
+
+	registry, err := name.NewRegistry(host)
+	if err != nil {
+		return prefix
+	}
+
+	return registry.RegistryStr() + "/" + rest
+}
+
+// rewrite returns the reference with the rule applied and whether the rule matched.
+func (m *MirrorRule) rewrite(reference string) (string, bool) {
+	if m.pattern != nil {
+		if !m.pattern.MatchString(reference) {
+			return reference, false
+		}
+
+		return m.pattern.ReplaceAllString(reference, m.Replacement), true
+	}
+
+	if m.Prefix == "" || !strings.HasPrefix(reference, m.Prefix) {
+		return reference, false
+	}
+
+	return m.Replacement + strings.TrimPrefix(reference, m.Prefix), true
+}
+
+// mirrorImage applies the first matching mirror rule to a fully qualified reference.
+// It returns nil if no rule matches.
+func (s *Service) mirrorImage(reference string) (string, *MirrorRule) {
+	for i := range s.mirrors {
+		if mirrored, ok := s.mirrors[i].rewrite(reference); ok {
+			return mirrored, &s.mirrors[i]
+		}
+	}
+
+	return reference, nil
+}
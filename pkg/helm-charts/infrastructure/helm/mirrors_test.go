@@ -0,0 +1,153 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"testing"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+func TestMirrorRule_rewrite(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      MirrorRule
+		reference string
+		want      string
+		wantMatch bool
+		wantErr   bool
+	}{
+		{
+			name:      "success: docker hub prefix with wildcard",
+			rule:      MirrorRule{Prefix: "docker.io/*", Replacement: "harbor.internal/dockerhub/*"},
+			reference: "index.docker.io/library/nginx:1.25",
+			want:      "harbor.internal/dockerhub/library/nginx:1.25",
+			wantMatch: true,
+		},
+		{
+			name:      "success: prefix does not match other registries",
+			rule:      MirrorRule{Prefix: "docker.io/", Replacement: "harbor.internal/dockerhub/"},
+			reference: "ghcr.io/fluxcd/source-controller:v1.2.0",
+			want:      "ghcr.io/fluxcd/source-controller:v1.2.0",
+			wantMatch: false,
+		},
+		{
+			name:      "success: regex with groups",
+			rule:      MirrorRule{Regex: `^(ghcr\.io|quay\.io)/(.+)$`, Replacement: "cache.internal/$1/$2"},
+			reference: "quay.io/prometheus/node-exporter:v1.8.0",
+			want:      "cache.internal/quay.io/prometheus/node-exporter:v1.8.0",
+			wantMatch: true,
+		},
+		{
+			name:      "success: regex without match",
+			rule:      MirrorRule{Regex: `^quay\.io/`, Replacement: "cache.internal/quay/"},
+			reference: "index.docker.io/library/nginx:1.25",
+			want:      "index.docker.io/library/nginx:1.25",
+			wantMatch: false,
+		},
+		{
+			name:    "fail: prefix and regex",
+			rule:    MirrorRule{Prefix: "docker.io/", Regex: "^docker", Replacement: "harbor.internal/"},
+			wantErr: true,
+		},
+		{
+			name:    "fail: missing replacement",
+			rule:    MirrorRule{Prefix: "docker.io/"},
+			wantErr: true,
+		},
+		{
+			name:    "fail: invalid regex",
+			rule:    MirrorRule{Regex: "([", Replacement: "harbor.internal/"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.compile()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MirrorRule.compile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			got, matched := tt.rule.rewrite(tt.reference)
+			if got != tt.want || matched != tt.wantMatch {
+				t.Errorf("MirrorRule.rewrite() = %v, %v, want %v, %v", got, matched, tt.want, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestService_lookupImage_mirror(t *testing.T) {
+	upstream := newTestRegistry(t)
+	mirror := newTestRegistry(t)
+
+	pushRandomImage(t, fmt.Sprintf("%s/library/nginx:1.25", upstream), 3)
+	pushRandomImage(t, fmt.Sprintf("%s/cache/library/nginx:1.25", mirror), 2)
+	pushRandomImage(t, fmt.Sprintf("%s/library/redis:7.2", upstream), 4)
+
+	tests := []struct {
+		name          string
+		image         string
+		fallback      bool
+		wantStatus    domain.ImageStatus
+		wantEffective string
+		wantFallback  bool
+		wantLayers    int
+	}{
+		{
+			name:          "success: looked up through the mirror",
+			image:         fmt.Sprintf("%s/library/nginx:1.25", upstream),
+			wantStatus:    domain.ImageStatusOK,
+			wantEffective: fmt.Sprintf("%s/cache/library/nginx:1.25", mirror),
+			wantLayers:    2,
+		},
+		{
+			name:          "success: falls back to upstream",
+			image:         fmt.Sprintf("%s/library/redis:7.2", upstream),
+			fallback:      true,
+			wantStatus:    domain.ImageStatusOK,
+			wantEffective: fmt.Sprintf("%s/library/redis:7.2", upstream),
+			wantFallback:  true,
+			wantLayers:    4,
+		},
+		{
+			name:          "fail: missing from mirror without fallback",
+			image:         fmt.Sprintf("%s/library/redis:7.2", upstream),
+			wantStatus:    domain.ImageStatusNotFound,
+			wantEffective: fmt.Sprintf("%s/cache/library/redis:7.2", mirror),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			rule := MirrorRule{Prefix: upstream + "/*", Replacement: mirror + "/cache/*", Fallback: tt.fallback}
+			if err := rule.compile(); err != nil {
+				t.Fatalf("MirrorRule.compile() error = %v", err)
+			}
+
+			s := NewHelmService(logger, WithRegistryConfig(&RegistryConfig{Mirrors: []MirrorRule{rule}}), withLoopback())
+
+			usage := &imageUsage{image: tt.image, reference: normalizeImage(tt.image)}
+
+			got := s.lookupImage(context.Background(), usage, &lookupOptions{})
+
+			if got.Status != tt.wantStatus {
+				t.Errorf("Service.lookupImage() status = %v, want %v (error: %s)", got.Status, tt.wantStatus, got.Error)
+				return
+			}
+
+			if got.Image != tt.image || got.Reference != usage.reference || got.EffectiveReference != tt.wantEffective ||
+				got.MirrorFallback != tt.wantFallback || got.Layers != tt.wantLayers {
+				t.Errorf("Service.lookupImage() = %+v", got)
+			}
+		})
+	}
+}
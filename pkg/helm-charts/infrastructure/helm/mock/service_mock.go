@@ -2,31 +2,99 @@ package mock
 
 import (
 	"context"
+	"io"
 
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
 )
 
 // HelmMock mocks the interface for methods exposed our helm infrastructure
 type HelmMock struct {
-	MockProcessHelmChartFn func(ctx context.Context, path string) ([]*domain.ImageDetails, error)
+	MockProcessHelmChartFn        func(ctx context.Context, input *domain.HelmLinkInput) (*domain.ChartScanResult, error)
+	MockProcessHelmChartArchiveFn func(ctx context.Context, archive io.Reader) (*domain.ChartScanResult, error)
+	MockProcessHelmChartBatchFn   func(ctx context.Context, inputs []*domain.HelmLinkInput) []*domain.BatchChartResult
+	MockPurgeImageCacheFn         func(ctx context.Context, image string) (*domain.CachePurgeResult, error)
+	MockPurgeChartCacheFn         func(ctx context.Context) (*domain.CachePurgeResult, error)
 }
 
 // NewHelmServiceMock ...
 func NewHelmServiceMock() *HelmMock {
+	result := &domain.ChartScanResult{
+		Chart: &domain.ChartDetails{
+			URL:     "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz",
+			Name:    "hello-world",
+			Version: "0.1.0",
+			Digest:  "sha256:4a7fcd5e8a0dc7e5a7c7d2a2e7dd9e7d3bd0bd1e0e5c1e22c6b4d6b8e0f5b6d1",
+		},
+		Summary: &domain.ScanSummary{
+			Total:     1,
+			Succeeded: 1,
+		},
+		Layers: &domain.LayerSummary{
+			TotalLayers:  2,
+			UniqueLayers: 2,
+			TotalSize:    123456,
+			UniqueSize:   123456,
+			Shared:       []domain.SharedLayer{},
+		},
+		Images: []*domain.ImageDetails{
+			{
+				Image:              "nginx:1.16.0",
+				Reference:          "index.docker.io/library/nginx:1.16.0",
+				EffectiveReference: "index.docker.io/library/nginx:1.16.0",
+				Status:             domain.ImageStatusOK,
+				Size:               123456,
+				Layers:             2,
+				Occurrences:        1,
+			},
+		},
+	}
+
 	return &HelmMock{
-		MockProcessHelmChartFn: func(_ context.Context, _ string) ([]*domain.ImageDetails, error) {
-			return []*domain.ImageDetails{
-				{
-					Image:  "nginx:1.16.0",
-					Size:   123456,
-					Layers: 2,
-				},
-			}, nil
+		MockProcessHelmChartFn: func(_ context.Context, _ *domain.HelmLinkInput) (*domain.ChartScanResult, error) {
+			return result, nil
+		},
+		MockProcessHelmChartArchiveFn: func(_ context.Context, _ io.Reader) (*domain.ChartScanResult, error) {
+			return result, nil
+		},
+		MockProcessHelmChartBatchFn: func(_ context.Context, inputs []*domain.HelmLinkInput) []*domain.BatchChartResult {
+			results := make([]*domain.BatchChartResult, len(inputs))
+
+			for i := range inputs {
+				results[i] = &domain.BatchChartResult{Index: i, Result: result}
+			}
+
+			return results
+		},
+		MockPurgeImageCacheFn: func(_ context.Context, _ string) (*domain.CachePurgeResult, error) {
+			return &domain.CachePurgeResult{Purged: 2}, nil
+		},
+		MockPurgeChartCacheFn: func(_ context.Context) (*domain.CachePurgeResult, error) {
+			return &domain.CachePurgeResult{Purged: 3}, nil
 		},
 	}
 }
 
 // ProcessHelmChart mocks the implementation of processing a helm chart
-func (h HelmMock) ProcessHelmChart(ctx context.Context, path string) ([]*domain.ImageDetails, error) {
-	return h.MockProcessHelmChartFn(ctx, path)
+func (h HelmMock) ProcessHelmChart(ctx context.Context, input *domain.HelmLinkInput) (*domain.ChartScanResult, error) {
+	return h.MockProcessHelmChartFn(ctx, input)
+}
+
+// ProcessHelmChartArchive mocks the implementation of processing an uploaded helm chart
+func (h HelmMock) ProcessHelmChartArchive(ctx context.Context, archive io.Reader) (*domain.ChartScanResult, error) {
+	return h.MockProcessHelmChartArchiveFn(ctx, archive)
+}
+
+// ProcessHelmChartBatch mocks the implementation of processing a batch of helm charts
+func (h HelmMock) ProcessHelmChartBatch(ctx context.Context, inputs []*domain.HelmLinkInput) []*domain.BatchChartResult {
+	return h.MockProcessHelmChartBatchFn(ctx, inputs)
+}
+
+// PurgeImageCache mocks the implementation of purging the image cache
+func (h HelmMock) PurgeImageCache(ctx context.Context, image string) (*domain.CachePurgeResult, error) {
+	return h.MockPurgeImageCacheFn(ctx, image)
+}
+
+// PurgeChartCache mocks the implementation of purging the chart cache
+func (h HelmMock) PurgeChartCache(ctx context.Context) (*domain.CachePurgeResult, error) {
+	return h.MockPurgeChartCacheFn(ctx)
 }
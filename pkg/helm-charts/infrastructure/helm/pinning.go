@@ -0,0 +1,277 @@
+package helm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// valueOverride sets the value at a path of the chart values
+type valueOverride struct {
+	path  []string
+	value string
+}
+
+// pinReference reports whether reference is pinned by digest, and returns its repository pinned
+// to digest when the digest is known.
+func pinReference(reference, digest string) (bool, string) {
+	ref, err := name.ParseReference(reference)
+	if err != nil {
+		return false, ""
+	}
+
+	_, pinned := ref.(name.Digest)
+
+	if digest == "" {
+		return pinned, ""
+	}
+
+	return pinned, ref.Context().Digest(digest).Name()
+}
+
+// chartValues reads the default values of a packaged chart.
+func chartValues(chartPath string) (map[string]interface{}, error) {
+	file, err := os.Open(chartPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	_, values, err := readChartValues(file)
+
+	return values, err
+}
+
+// readChartValues reads the values.yaml of a packaged chart and returns it with the name of the chart
+// directory. The defaults of packaged and unpacked subcharts are nested under the subchart name, below
+// any values the parent sets for it, the way helm coalesces them. Aliased subcharts are not recognised.
+func readChartValues(archive io.Reader) (string, map[string]interface{}, error) {
+	gzipReader, err := gzip.NewReader(archive)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid chart archive: %w", err)
+	}
+
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+
+	var chartName string
+
+	values := map[string]interface{}{}
+	subcharts := map[string]map[string]interface{}{}
+
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid chart archive: %w", err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		parts := strings.Split(path.Clean(header.Name), "/")
+
+		switch {
+		case len(parts) == 2 && parts[1] == "values.yaml":
+			chartName = parts[0]
+
+			if err := decodeValues(tarReader, values); err != nil {
+				return "", nil, fmt.Errorf("invalid values.yaml: %w", err)
+			}
+		case len(parts) == 3 && parts[1] == "charts" && strings.HasSuffix(parts[2], ".tgz"):
+			subchart, subchartValues, err := readChartValues(tarReader)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid subchart %s: %w", parts[2], err)
+			}
+
+			if subchart != "" {
+				subcharts[subchart] = subchartValues
+			}
+		case len(parts) == 4 && parts[1] == "charts" && parts[3] == "values.yaml":
+			subchartValues := map[string]interface{}{}
+
+			if err := decodeValues(tarReader, subchartValues); err != nil {
+				return "", nil, fmt.Errorf("invalid values.yaml of subchart %s: %w", parts[2], err)
+			}
+
+			subcharts[parts[2]] = subchartValues
+		}
+	}
+
+	for subchart, defaults := range subcharts {
+		overrides, _ := values[subchart].(map[string]interface{})
+		values[subchart] = coalesceValues(overrides, defaults)
+	}
+
+	return chartName, values, nil
+}
+
+// decodeValues decodes a values document into values. Empty documents leave values untouched.
+func decodeValues(reader io.Reader, values map[string]interface{}) error {
+	err := yaml.NewDecoder(reader).Decode(&values)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	return err
+}
+
+// coalesceValues merges overrides into defaults, recursing into tables present in both.
+func coalesceValues(overrides, defaults map[string]interface{}) map[string]interface{} {
+	merged := maps.Clone(defaults)
+	if merged == nil {
+		merged = map[string]interface{}{}
+	}
+
+	for key, value := range overrides {
+		overrideTable, ok := value.(map[string]interface{})
+		defaultTable, isTable := merged[key].(map[string]interface{})
+
+		if ok && isTable {
+			merged[key] = coalesceValues(overrideTable, defaultTable)
+
+			continue
+		}
+
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// scalarValue formats a string or number value, as YAML would write it.
+func scalarValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case int, float64:
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
+
+// pinOverrides finds the values that set image, walking tables in key order, and returns the
+// overrides pinning it to pinned. Images are recognised as strings under a key mentioning image,
+// or as tables with a repository and optional registry and tag, in which case the digest key
+// is set when the chart has one, and the digest is appended to the tag otherwise.
+func pinOverrides(values map[string]interface{}, valuesPath []string, image *domain.ImageDetails) []valueOverride {
+	ref, err := name.NewTag(image.Reference)
+	if err != nil {
+		return nil
+	}
+
+	var overrides []valueOverride
+
+	if repository, ok := values["repository"].(string); ok && repository != "" {
+		candidate := repository
+		if registry, ok := values["registry"].(string); ok && registry != "" {
+			candidate = registry + "/" + repository
+		}
+
+		tag, _ := scalarValue(values["tag"])
+
+		candidateRef, err := name.ParseReference(candidate)
+		if err == nil && candidateRef.Context().Name() == ref.Context().Name() && (tag == "" || tag == ref.TagStr()) {
+			if _, ok := values["digest"]; ok {
+				return []valueOverride{{path: append(slices.Clone(valuesPath), "digest"), value: image.Digest}}
+			}
+
+			return []valueOverride{{path: append(slices.Clone(valuesPath), "tag"), value: ref.TagStr() + "@" + image.Digest}}
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		keyPath := append(slices.Clone(valuesPath), key)
+
+		switch value := values[key].(type) {
+		case map[string]interface{}:
+			overrides = append(overrides, pinOverrides(value, keyPath, image)...)
+		case string:
+			if strings.Contains(strings.ToLower(key), "image") && normalizeImage(value) == image.Reference {
+				overrides = append(overrides, valueOverride{path: keyPath, value: image.PinnedReference})
+			}
+		}
+	}
+
+	return overrides
+}
+
+// setValue sets the value at path, creating the tables along the way.
+func setValue(values map[string]interface{}, valuesPath []string, value string) {
+	for _, key := range valuesPath[:len(valuesPath)-1] {
+		table, ok := values[key].(map[string]interface{})
+		if !ok {
+			table = map[string]interface{}{}
+			values[key] = table
+		}
+
+		values = table
+	}
+
+	values[valuesPath[len(valuesPath)-1]] = value
+}
+
+// suggestPins builds a values override pinning every floating image of the chart that was looked up
+// and is set by the default values of the chart to its digest.
+func suggestPins(chartPath string, images []*domain.ImageDetails) (*domain.PinSuggestion, error) {
+	values, err := chartValues(chartPath)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestion := &domain.PinSuggestion{Pinned: []string{}, Unpinned: []string{}}
+
+	override := map[string]interface{}{}
+
+	for _, image := range images {
+		if image.Pinned {
+			continue
+		}
+
+		var overrides []valueOverride
+		if image.PinnedReference != "" {
+			overrides = pinOverrides(values, nil, image)
+		}
+
+		if len(overrides) == 0 {
+			suggestion.Unpinned = append(suggestion.Unpinned, image.Reference)
+
+			continue
+		}
+
+		for _, o := range overrides {
+			setValue(override, o.path, o.value)
+		}
+
+		suggestion.Pinned = append(suggestion.Pinned, image.Reference)
+	}
+
+	if len(override) > 0 {
+		document, err := yaml.Marshal(override)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestion.Values = string(document)
+	}
+
+	return suggestion, nil
+}
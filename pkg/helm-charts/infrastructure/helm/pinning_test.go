@@ -0,0 +1,172 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"gopkg.in/yaml.v3"
+)
+
+const testDigest = "sha256:4a7fcd5e8a0dc7e5a7c7d2a2e7dd9e7d3bd0bd1e0e5c1e22c6b4d6b8e0f5b6d1"
+
+func TestPinReference(t *testing.T) {
+	tests := []struct {
+		name          string
+		reference     string
+		digest        string
+		wantPinned    bool
+		wantReference string
+	}{
+		{
+			name:          "success: floating tag",
+			reference:     "index.docker.io/library/nginx:1.16",
+			digest:        testDigest,
+			wantReference: "index.docker.io/library/nginx@" + testDigest,
+		},
+		{
+			name:          "success: pinned by digest",
+			reference:     "index.docker.io/library/nginx@" + testDigest,
+			digest:        testDigest,
+			wantPinned:    true,
+			wantReference: "index.docker.io/library/nginx@" + testDigest,
+		},
+		{
+			name:      "success: unknown digest",
+			reference: "index.docker.io/library/nginx:latest",
+		},
+		{
+			name:      "fail: invalid reference",
+			reference: "nginx@latest@v1",
+			digest:    testDigest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinned, reference := pinReference(tt.reference, tt.digest)
+			if pinned != tt.wantPinned || reference != tt.wantReference {
+				t.Errorf("pinReference() = %v, %q, want %v, %q", pinned, reference, tt.wantPinned, tt.wantReference)
+			}
+		})
+	}
+}
+
+func TestReadChartValues(t *testing.T) {
+	subchart := buildChartArchive(t, map[string]string{
+		"postgresql/Chart.yaml":  "name: postgresql\nversion: 16.0.0\n",
+		"postgresql/values.yaml": "image:\n  repository: bitnami/postgresql\n  tag: \"16\"\nauth:\n  database: app\n",
+	})
+
+	archive := buildChartArchive(t, map[string]string{
+		"app/Chart.yaml":                testChartYAML,
+		"app/values.yaml":               "image: nginx:1.16\npostgresql:\n  auth:\n    database: override\n",
+		"app/charts/postgresql.tgz":     string(subchart),
+		"app/charts/cache/values.yaml":  "image:\n  repository: redis\n",
+		"app/templates/deployment.yaml": "kind: Deployment",
+	})
+
+	values, err := chartValues(writeChartArchive(t, archive))
+	if err != nil {
+		t.Fatalf("chartValues() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"image": "nginx:1.16",
+		"postgresql": map[string]interface{}{
+			"image": map[string]interface{}{"repository": "bitnami/postgresql", "tag": "16"},
+			"auth":  map[string]interface{}{"database": "override"},
+		},
+		"cache": map[string]interface{}{
+			"image": map[string]interface{}{"repository": "redis"},
+		},
+	}
+
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("chartValues() = %v, want %v", values, want)
+	}
+}
+
+func TestSuggestPins(t *testing.T) {
+	subchart := buildChartArchive(t, map[string]string{
+		"postgresql/Chart.yaml":  "name: postgresql\nversion: 16.0.0\n",
+		"postgresql/values.yaml": "image:\n  repository: bitnami/postgresql\n  tag: \"16\"\n",
+	})
+
+	chartPath := writeChartArchive(t, buildChartArchive(t, map[string]string{
+		"app/Chart.yaml": testChartYAML,
+		"app/values.yaml": `image:
+  registry: docker.io
+  repository: bitnami/redis
+  tag: 7.4.1
+  digest: ""
+exporter:
+  image:
+    repository: ghcr.io/example/exporter
+    tag: "1.0"
+sidecarImage: busybox:1.36
+nameOverride: busybox:1.36
+`,
+		"app/charts/postgresql.tgz": string(subchart),
+	}))
+
+	image := func(reference string, status domain.ImageStatus) *domain.ImageDetails {
+		details := &domain.ImageDetails{Reference: reference, Status: status}
+
+		if status == domain.ImageStatusOK {
+			details.Digest = testDigest
+		}
+
+		details.Pinned, details.PinnedReference = pinReference(reference, details.Digest)
+
+		return details
+	}
+
+	images := []*domain.ImageDetails{
+		image("index.docker.io/bitnami/redis:7.4.1", domain.ImageStatusOK),
+		image("ghcr.io/example/exporter:1.0", domain.ImageStatusOK),
+		image("index.docker.io/library/busybox:1.36", domain.ImageStatusOK),
+		image("index.docker.io/bitnami/postgresql:16", domain.ImageStatusOK),
+		image("index.docker.io/library/nginx@"+testDigest, domain.ImageStatusOK),
+		image("index.docker.io/library/templated:1", domain.ImageStatusOK),
+		image("ghcr.io/example/missing:1", domain.ImageStatusNotFound),
+	}
+
+	got, err := suggestPins(chartPath, images)
+	if err != nil {
+		t.Fatalf("suggestPins() error = %v", err)
+	}
+
+	wantValues := map[string]interface{}{
+		"image": map[string]interface{}{"digest": testDigest},
+		"exporter": map[string]interface{}{
+			"image": map[string]interface{}{"tag": "1.0@" + testDigest},
+		},
+		"sidecarImage": "index.docker.io/library/busybox@" + testDigest,
+		"postgresql": map[string]interface{}{
+			"image": map[string]interface{}{"tag": "16@" + testDigest},
+		},
+	}
+
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(got.Values), &values); err != nil {
+		t.Fatalf("suggestPins() returned invalid values: %v", err)
+	}
+
+	if !reflect.DeepEqual(values, wantValues) {
+		t.Errorf("suggestPins() values = %v, want %v", values, wantValues)
+	}
+
+	wantPinned := []string{
+		"index.docker.io/bitnami/redis:7.4.1",
+		"ghcr.io/example/exporter:1.0",
+		"index.docker.io/library/busybox:1.36",
+		"index.docker.io/bitnami/postgresql:16",
+	}
+
+	wantUnpinned := []string{"index.docker.io/library/templated:1", "ghcr.io/example/missing:1"}
+
+	if !reflect.DeepEqual(got.Pinned, wantPinned) || !reflect.DeepEqual(got.Unpinned, wantUnpinned) {
+		t.Errorf("suggestPins() pinned = %v, unpinned = %v", got.Pinned, got.Unpinned)
+	}
+}
@@ -0,0 +1,193 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+// errPlatformNotFound is returned when a multi-architecture image has no manifest for the requested platform
+var errPlatformNotFound = errors.New("no image found for the requested platform")
+
+// defaultPlatform is the platform reported at the top level of a multi-architecture image
+// when no platform is requested, matching what remote.Image resolves to
+var defaultPlatform = v1.Platform{OS: "linux", Architecture: "amd64"}
+
+// lookupOptions controls how image metadata is fetched from registries
+type lookupOptions struct {
+	platform     *v1.Platform
+	inspect      bool
+	uncompressed bool
+}
+
+// key identifies the options that change the details reported for an image.
+func (o *lookupOptions) key() string {
+	var key string
+
+	if o.platform != nil {
+		key = o.platform.String()
+	}
+
+	if o.inspect {
+		key += "|inspect"
+	}
+
+	if o.uncompressed {
+		key += "|uncompressed"
+	}
+
+	return key
+}
+
+// newLookupOptions validates the image options of a request.
+func newLookupOptions(options *domain.ImageOptions) (*lookupOptions, error) {
+	opts := &lookupOptions{}
+
+	if options == nil {
+		return opts, nil
+	}
+
+	opts.inspect = options.Inspect
+	opts.uncompressed = options.UncompressedSizes
+
+	if options.Platform == "" {
+		return opts, nil
+	}
+
+	platform, err := v1.ParsePlatform(options.Platform)
+	if err != nil {
+		return nil, fmt.Errorf("invalid platform %q: %w", options.Platform, err)
+	}
+
+	if platform.OS == "" || platform.Architecture == "" {
+		return nil, fmt.Errorf("invalid platform %q: expected os/arch[/variant]", options.Platform)
+	}
+
+	opts.platform = platform
+
+	return opts, nil
+}
+
+// manifestSize sums the compressed size of the layers of an image and lists them.
+func manifestSize(img v1.Image) (int64, []domain.ImageLayer, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	size := int64(0)
+	layers := make([]domain.ImageLayer, 0, len(manifest.Layers))
+
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+		layers = append(layers, domain.ImageLayer{Digest: layer.Digest.String(), Size: layer.Size})
+	}
+
+	return size, layers, nil
+}
+
+// mergeAnnotations combines the annotations of an index with those of the selected image manifest,
+// which take precedence.
+func mergeAnnotations(index, manifest map[string]string) map[string]string {
+	if len(index) == 0 {
+		return manifest
+	}
+
+	merged := maps.Clone(index)
+	maps.Copy(merged, manifest)
+
+	return merged
+}
+
+// isRunnablePlatform filters out index entries that are not images for a real platform,
+// such as attestation manifests which are published under unknown/unknown.
+func isRunnablePlatform(desc v1.Descriptor) bool {
+	if desc.Platform == nil || desc.MediaType.IsIndex() {
+		return false
+	}
+
+	return desc.Platform.OS != "unknown" && desc.Platform.Architecture != "unknown"
+}
+
+// fetchIndexDetails reports every platform of a multi-architecture image. The top level size and
+// layers are those of the requested platform, or of the default platform when none is requested.
+func (s *Service) fetchIndexDetails(image string, desc *remote.Descriptor, opts *lookupOptions) (*domain.ImageDetails, error) {
+	index, err := desc.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	details := &domain.ImageDetails{Image: image}
+
+	var (
+		selected       *domain.PlatformDetails
+		selectedLayers []domain.ImageLayer
+		selectedImage  v1.Image
+	)
+
+	for _, manifest := range indexManifest.Manifests {
+		if !isRunnablePlatform(manifest) {
+			continue
+		}
+
+		if opts.platform != nil && !manifest.Platform.Satisfies(*opts.platform) {
+			continue
+		}
+
+		img, err := index.Image(manifest.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		size, layers, err := manifestSize(img)
+		if err != nil {
+			return nil, err
+		}
+
+		details.Platforms = append(details.Platforms, domain.PlatformDetails{
+			OS:           manifest.Platform.OS,
+			Architecture: manifest.Platform.Architecture,
+			Variant:      manifest.Platform.Variant,
+			Digest:       manifest.Digest.String(),
+			Size:         size,
+			Layers:       len(layers),
+		})
+
+		if selected == nil || (opts.platform == nil && manifest.Platform.Satisfies(defaultPlatform)) {
+			selected = &details.Platforms[len(details.Platforms)-1]
+			selectedLayers = layers
+			selectedImage = img
+		}
+	}
+
+	if selected == nil {
+		if opts.platform != nil {
+			return nil, fmt.Errorf("%w: %s", errPlatformNotFound, opts.platform)
+		}
+
+		return nil, fmt.Errorf("%w: index lists no runnable platforms", errPlatformNotFound)
+	}
+
+	details.Size = selected.Size
+	details.Layers = selected.Layers
+	details.LayerDetails = selectedLayers
+
+	if err := inspectImage(selectedImage, details, opts); err != nil {
+		return nil, err
+	}
+
+	if details.Config != nil {
+		details.Config.Annotations = mergeAnnotations(indexManifest.Annotations, details.Config.Annotations)
+	}
+
+	return details, nil
+}
@@ -0,0 +1,182 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+// pushMultiPlatformImage pushes an index with one random image per platform to reference.
+// The image for the platform at position i has i+1 layers.
+func pushMultiPlatformImage(t *testing.T, reference string, platforms ...v1.Platform) {
+	t.Helper()
+
+	ref, err := name.ParseReference(reference)
+	if err != nil {
+		t.Fatalf("invalid reference %s: %v", reference, err)
+	}
+
+	var index v1.ImageIndex = empty.Index
+
+	for i := range platforms {
+		img, err := random.Image(1024, int64(i+1))
+		if err != nil {
+			t.Fatalf("failed to build image: %v", err)
+		}
+
+		index = mutate.AppendManifests(index, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				Platform: &platforms[i],
+			},
+		})
+	}
+
+	if err := remote.WriteIndex(ref, index); err != nil {
+		t.Fatalf("failed to push index: %v", err)
+	}
+}
+
+func TestNewLookupOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		want     *v1.Platform
+		wantErr  bool
+	}{
+		{
+			name:     "success: no platform",
+			platform: "",
+			want:     nil,
+			wantErr:  false,
+		},
+		{
+			name:     "success: os and architecture",
+			platform: "linux/arm64",
+			want:     &v1.Platform{OS: "linux", Architecture: "arm64"},
+			wantErr:  false,
+		},
+		{
+			name:     "success: with variant",
+			platform: "linux/arm/v7",
+			want:     &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+			wantErr:  false,
+		},
+		{
+			name:     "fail: missing architecture",
+			platform: "linux",
+			wantErr:  true,
+		},
+		{
+			name:     "fail: too many parts",
+			platform: "linux/arm/v7/extra",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newLookupOptions(&domain.ImageOptions{Platform: tt.platform})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newLookupOptions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if (got.platform == nil) != (tt.want == nil) || (tt.want != nil && !got.platform.Equals(*tt.want)) {
+				t.Errorf("newLookupOptions() = %v, want %v", got.platform, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_fetchImageDetails_multiPlatform(t *testing.T) {
+	host := newTestRegistry(t)
+
+	image := fmt.Sprintf("%s/library/redis:7.2", host)
+
+	pushMultiPlatformImage(t, image,
+		v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+		v1.Platform{OS: "unknown", Architecture: "unknown"},
+	)
+
+	tests := []struct {
+		name          string
+		platform      string
+		wantPlatforms []string
+		wantLayers    int
+		wantStatus    domain.ImageStatus
+	}{
+		{
+			name:          "success: every platform, amd64 at the top level",
+			wantPlatforms: []string{"linux/arm/v7", "linux/amd64", "linux/arm64"},
+			wantLayers:    2,
+			wantStatus:    domain.ImageStatusOK,
+		},
+		{
+			name:          "success: selected platform",
+			platform:      "linux/arm64",
+			wantPlatforms: []string{"linux/arm64"},
+			wantLayers:    3,
+			wantStatus:    domain.ImageStatusOK,
+		},
+		{
+			name:          "success: selected platform with variant",
+			platform:      "linux/arm/v7",
+			wantPlatforms: []string{"linux/arm/v7"},
+			wantLayers:    1,
+			wantStatus:    domain.ImageStatusOK,
+		},
+		{
+			name:       "fail: platform not published",
+			platform:   "windows/amd64",
+			wantStatus: domain.ImageStatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger, withLoopback())
+
+			opts, err := newLookupOptions(&domain.ImageOptions{Platform: tt.platform})
+			if err != nil {
+				t.Fatalf("newLookupOptions() error = %v", err)
+			}
+
+			got := s.lookupImage(context.Background(), &imageUsage{image: image, reference: normalizeImage(image)}, opts)
+
+			if got.Status != tt.wantStatus {
+				t.Errorf("Service.lookupImage() status = %v, want %v (error: %s)", got.Status, tt.wantStatus, got.Error)
+				return
+			}
+
+			if got.Layers != tt.wantLayers || len(got.LayerDetails) != tt.wantLayers || len(got.Platforms) != len(tt.wantPlatforms) {
+				t.Errorf("Service.lookupImage() = %+v", got)
+				return
+			}
+
+			for i, platform := range got.Platforms {
+				reported := (&v1.Platform{OS: platform.OS, Architecture: platform.Architecture, Variant: platform.Variant}).String()
+				if reported != tt.wantPlatforms[i] || platform.Digest == "" {
+					t.Errorf("Service.lookupImage() platform %d = %+v, want %s", i, platform, tt.wantPlatforms[i])
+				}
+			}
+		})
+	}
+}
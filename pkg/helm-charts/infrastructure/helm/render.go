@@ -0,0 +1,294 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+const (
+	// templateReleaseName is the release name charts are rendered with, the default of helm template
+	templateReleaseName = "release-name"
+
+	// templateNamespace is the namespace charts are rendered into
+	templateNamespace = "default"
+
+	// notesTemplate renders the usage notes of a chart, which are not a manifest
+	notesTemplate = "NOTES.txt"
+
+	// DefaultRenderConcurrency is the number of charts rendered in-process at the same time
+	DefaultRenderConcurrency = 4
+)
+
+// renderedTemplate holds the documents rendered from one chart template
+type renderedTemplate struct {
+	Name     string `json:"name"`
+	Manifest string `json:"manifest"`
+}
+
+// renderer renders a packaged chart with the given values into its templates
+type renderer interface {
+	render(ctx context.Context, chartPath string, values *renderValues) ([]renderedTemplate, error)
+}
+
+// WithExecRenderer renders charts by running helm template with the helm binary on PATH
+// instead of rendering them in-process.
+func WithExecRenderer() Option {
+	return func(s *Service) {
+		s.renderer = &execRenderer{}
+	}
+}
+
+// WithRenderConcurrency bounds the number of charts rendered in-process at the same time. A render
+// abandoned on cancellation holds on to its slot until the Helm engine is done, so charts that keep
+// rendering block new renders instead of piling up.
+func WithRenderConcurrency(concurrency int) Option {
+	return func(s *Service) {
+		s.renderConcurrency = max(concurrency, 1)
+	}
+}
+
+// sdkRenderer renders charts in-process with the Helm library, the way helm template does
+type sdkRenderer struct {
+	// slots holds a token for every chart the engine is rendering
+	slots chan struct{}
+}
+
+// newSdkRenderer returns a renderer rendering at most concurrency charts at the same time.
+func newSdkRenderer(concurrency int) *sdkRenderer {
+	return &sdkRenderer{slots: make(chan struct{}, concurrency)}
+}
+
+// renderOutput is the outcome of rendering a chart's templates with the Helm engine
+type renderOutput struct {
+	files map[string]string
+	err   error
+}
+
+// render loads the chart and renders its templates with the Helm engine, using the release options
+// and default capabilities of helm template, then sorts the rendered documents into manifests and
+// hooks keyed by the template they came from. The engine cannot be interrupted: on cancellation
+// render returns right away, but the rendering goroutine keeps running, and using CPU and memory,
+// until the chart has been rendered completely. It keeps its render slot until then, so at most
+// the configured number of charts are ever rendering, and render waits for a free slot until ctx
+// is done.
+func (r *sdkRenderer) render(ctx context.Context, chartPath string, renderValues *renderValues) ([]renderedTemplate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to render helm chart: %w", err)
+	}
+
+	chart, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load helm chart: %w", err)
+	}
+
+	if dependencies := chart.Metadata.Dependencies; dependencies != nil {
+		if err := action.CheckDependencies(chart, dependencies); err != nil {
+			return nil, fmt.Errorf("failed to render helm chart: %w", err)
+		}
+	}
+
+	options := &values.Options{ValueFiles: renderValues.files, Values: renderValues.set}
+
+	vals, err := options.MergeValues(getter.Providers{})
+	if err != nil {
+		return nil, fmt.Errorf("invalid values: %w", err)
+	}
+
+	if err := chartutil.ProcessDependenciesWithMerge(chart, vals); err != nil {
+		return nil, fmt.Errorf("failed to render helm chart: %w", err)
+	}
+
+	capabilities := chartutil.DefaultCapabilities
+
+	if kubeVersion := chart.Metadata.KubeVersion; kubeVersion != "" &&
+		!chartutil.IsCompatibleRange(kubeVersion, capabilities.KubeVersion.String()) {
+		return nil, fmt.Errorf("failed to render helm chart: chart requires kubeVersion %s which is incompatible with Kubernetes %s",
+			kubeVersion, capabilities.KubeVersion.String())
+	}
+
+	releaseOptions := chartutil.ReleaseOptions{
+		Name: templateReleaseName, Namespace: templateNamespace, Revision: 1, IsInstall: true,
+	}
+
+	renderVals, err := chartutil.ToRenderValues(chart, vals, releaseOptions, capabilities)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render helm chart: %w", err)
+	}
+
+	select {
+	case r.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to render helm chart: %w", ctx.Err())
+	}
+
+	done := make(chan renderOutput, 1)
+
+	go func() {
+		files, err := engine.Render(chart, renderVals)
+
+		<-r.slots
+
+		done <- renderOutput{files: files, err: err}
+	}()
+
+	var output renderOutput
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to render helm chart: %w", ctx.Err())
+	case output = <-done:
+	}
+
+	if output.err != nil {
+		return nil, fmt.Errorf("failed to render helm chart: %w", output.err)
+	}
+
+	for name := range output.files {
+		if path.Base(name) == notesTemplate {
+			delete(output.files, name)
+		}
+	}
+
+	hooks, manifests, err := releaseutil.SortManifests(output.files, nil, releaseutil.InstallOrder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render helm chart: %w", err)
+	}
+
+	templates := &templateDocuments{index: map[string]int{}}
+
+	for _, manifest := range manifests {
+		templates.add(manifest.Name, manifest.Content)
+	}
+
+	for _, hook := range hooks {
+		templates.add(hook.Path, hook.Manifest)
+	}
+
+	return templates.rendered, nil
+}
+
+// templateDocuments groups rendered documents by template, in the order templates first appear
+type templateDocuments struct {
+	rendered []renderedTemplate
+	index    map[string]int
+}
+
+// add appends a document rendered from the named template.
+func (d *templateDocuments) add(name, document string) {
+	document = strings.TrimSpace(document) + "\n"
+
+	i, ok := d.index[name]
+	if !ok {
+		d.index[name] = len(d.rendered)
+		d.rendered = append(d.rendered, renderedTemplate{Name: name, Manifest: document})
+
+		return
+	}
+
+	d.rendered[i].Manifest += "---\n" + document
+}
+
+// execRenderer renders charts with helm template, using the helm binary on PATH
+type execRenderer struct{}
+
+// render runs helm template, killing it when ctx is canceled, and splits its output by template.
+func (r *execRenderer) render(ctx context.Context, chartPath string, values *renderValues) ([]renderedTemplate, error) {
+	args := append([]string{"template", chartPath}, values.args()...)
+
+	cmd := exec.CommandContext(ctx, "helm", args...)
+
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to render helm chart: %w", ctx.Err())
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("failed to render helm chart: %w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+
+		return nil, fmt.Errorf("failed to render helm chart: %w", err)
+	}
+
+	return splitManifest(string(output)), nil
+}
+
+// splitManifest splits rendered multi-document YAML by the "# Source:" comment helm writes at the
+// top of each document. Consecutive documents of the same template are kept together.
+func splitManifest(manifest string) []renderedTemplate {
+	var templates []renderedTemplate
+
+	for _, document := range splitDocuments(manifest) {
+		name := documentSource(document)
+
+		if last := len(templates) - 1; last >= 0 && templates[last].Name == name {
+			templates[last].Manifest += "---\n" + document
+
+			continue
+		}
+
+		templates = append(templates, renderedTemplate{Name: name, Manifest: document})
+	}
+
+	return templates
+}
+
+// splitDocuments splits multi-document YAML on its document separators, dropping empty documents.
+func splitDocuments(manifest string) []string {
+	var (
+		documents []string
+		current   strings.Builder
+	)
+
+	flush := func() {
+		if strings.TrimSpace(current.String()) != "" {
+			documents = append(documents, current.String())
+		}
+
+		current.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(manifest, "\n") {
+		if strings.TrimRight(line, " \t\r\n") == "---" {
+			flush()
+
+			continue
+		}
+
+		current.WriteString(line)
+	}
+
+	flush()
+
+	return documents
+}
+
+// documentSource returns the template named by the "# Source:" comment heading a document.
+func documentSource(document string) string {
+	for _, line := range strings.Split(document, "\n") {
+		line = strings.TrimSpace(line)
+
+		if template, ok := strings.CutPrefix(line, sourceCommentPrefix); ok {
+			return strings.TrimSpace(template)
+		}
+
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return ""
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,326 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testRenderChart is a chart with a subchart, templates rendering two documents, a hook, notes and
+// a template that renders nothing
+func testRenderChart(t *testing.T) string {
+	t.Helper()
+
+	return writeChartArchive(t, buildChartArchive(t, map[string]string{
+		"web/Chart.yaml": `apiVersion: v2
+name: web
+version: 1.0.0
+dependencies:
+  - name: cache
+    version: 1.0.0
+    condition: cache.enabled
+`,
+		"web/values.yaml": "image:\n  repository: nginx\n  tag: \"1.25\"\ncache:\n  enabled: true\n",
+		"web/templates/deployment.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Release.Name }}-web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}-web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+`,
+		"web/templates/pods.yaml": `apiVersion: v1
+kind: Pod
+metadata:
+  name: first
+spec:
+  containers:
+    - name: busybox
+      image: busybox:1.36
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: second
+spec:
+  containers:
+    - name: alpine
+      image: alpine:3.20
+`,
+		"web/templates/migrate.yaml": `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-install
+spec:
+  template:
+    spec:
+      containers:
+        - name: migrate
+          image: migrate/migrate:v4
+`,
+		"web/templates/empty.yaml":    "{{- if false }}\nkind: ConfigMap\n{{- end }}\n",
+		"web/templates/NOTES.txt":     "Reach {{ .Release.Name }}-web on port 80.\n",
+		"web/templates/_helpers.tpl":  "{{- define \"web.name\" -}}web{{- end -}}\n",
+		"web/charts/cache/Chart.yaml": "apiVersion: v2\nname: cache\nversion: 1.0.0\n",
+		"web/charts/cache/templates/statefulset.yaml": `apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: cache
+spec:
+  template:
+    spec:
+      containers:
+        - name: redis
+          image: redis:7.4
+`,
+	}))
+}
+
+// templateNames returns the names of the rendered templates
+func templateNames(templates []renderedTemplate) []string {
+	names := make([]string, len(templates))
+
+	for i, template := range templates {
+		names[i] = template.Name
+	}
+
+	return names
+}
+
+// imageSources returns the images found in the rendered templates, keyed by image
+func imageSources(t *testing.T, templates []renderedTemplate) map[string]string {
+	t.Helper()
+
+	images, err := extractImages(templates)
+	if err != nil {
+		t.Fatalf("extractImages() error = %v", err)
+	}
+
+	sources := map[string]string{}
+
+	for _, image := range images {
+		sources[image.image] = image.source.Template
+	}
+
+	return sources
+}
+
+func TestSdkRenderer_render(t *testing.T) {
+	chartPath := testRenderChart(t)
+
+	tests := []struct {
+		name       string
+		values     *renderValues
+		wantImages map[string]string
+		wantNames  []string
+	}{
+		{
+			name:   "success: default values",
+			values: &renderValues{},
+			wantImages: map[string]string{
+				"nginx:1.25":         "web/templates/deployment.yaml",
+				"busybox:1.36":       "web/templates/pods.yaml",
+				"alpine:3.20":        "web/templates/pods.yaml",
+				"redis:7.4":          "web/charts/cache/templates/statefulset.yaml",
+				"migrate/migrate:v4": "web/templates/migrate.yaml",
+			},
+			wantNames: []string{
+				"web/templates/deployment.yaml",
+				"web/templates/pods.yaml",
+				"web/charts/cache/templates/statefulset.yaml",
+				"web/templates/migrate.yaml",
+			},
+		},
+		{
+			name:   "success: overrides and disabled subchart",
+			values: &renderValues{set: []string{"image.tag=1.27", "cache.enabled=false"}},
+			wantImages: map[string]string{
+				"nginx:1.27":         "web/templates/deployment.yaml",
+				"busybox:1.36":       "web/templates/pods.yaml",
+				"alpine:3.20":        "web/templates/pods.yaml",
+				"migrate/migrate:v4": "web/templates/migrate.yaml",
+			},
+			wantNames: []string{"web/templates/deployment.yaml", "web/templates/pods.yaml", "web/templates/migrate.yaml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newSdkRenderer(1)
+
+			got, err := r.render(context.Background(), chartPath, tt.values)
+			if err != nil {
+				t.Fatalf("sdkRenderer.render() error = %v", err)
+			}
+
+			if sources := imageSources(t, got); !reflect.DeepEqual(sources, tt.wantImages) {
+				t.Errorf("sdkRenderer.render() images = %v, want %v", sources, tt.wantImages)
+			}
+
+			if names := templateNames(got); !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("sdkRenderer.render() templates = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestSdkRenderer_render_errors(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	missingDependency := writeChartArchive(t, buildChartArchive(t, map[string]string{
+		"web/Chart.yaml": "apiVersion: v2\nname: web\nversion: 1.0.0\ndependencies:\n  - name: cache\n    version: 1.0.0\n",
+	}))
+
+	invalidTemplate := writeChartArchive(t, buildChartArchive(t, map[string]string{
+		"web/Chart.yaml":         testChartYAML,
+		"web/templates/pod.yaml": "image: {{ .Values.image.tag }",
+	}))
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		chartPath string
+		values    *renderValues
+		wantErr   error
+	}{
+		{
+			name:      "fail: canceled",
+			ctx:       canceled,
+			chartPath: testRenderChart(t),
+			values:    &renderValues{},
+			wantErr:   context.Canceled,
+		},
+		{
+			name:      "fail: missing dependency",
+			ctx:       context.Background(),
+			chartPath: missingDependency,
+			values:    &renderValues{},
+		},
+		{
+			name:      "fail: invalid template",
+			ctx:       context.Background(),
+			chartPath: invalidTemplate,
+			values:    &renderValues{},
+		},
+		{
+			name:      "fail: missing values file",
+			ctx:       context.Background(),
+			chartPath: testRenderChart(t),
+			values:    &renderValues{files: []string{"missing-values.yaml"}},
+		},
+		{
+			name:      "fail: not a chart",
+			ctx:       context.Background(),
+			chartPath: writeChartArchive(t, []byte("fake tarball content")),
+			values:    &renderValues{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newSdkRenderer(1)
+
+			_, err := r.render(tt.ctx, tt.chartPath, tt.values)
+			if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("sdkRenderer.render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSdkRenderer_render_concurrency(t *testing.T) {
+	chartPath := testRenderChart(t)
+
+	r := newSdkRenderer(1)
+
+	// an abandoned render still running in the engine
+	r.slots <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := r.render(ctx, chartPath, &renderValues{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("sdkRenderer.render() with every slot taken error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	<-r.slots
+
+	if _, err := r.render(context.Background(), chartPath, &renderValues{}); err != nil {
+		t.Errorf("sdkRenderer.render() with a free slot error = %v", err)
+	}
+
+	if len(r.slots) != 0 {
+		t.Errorf("sdkRenderer.render() kept %d slots after rendering", len(r.slots))
+	}
+}
+
+func TestExecRenderer_render(t *testing.T) {
+	if _, err := exec.LookPath("helm"); err != nil {
+		t.Skip("helm is not installed")
+	}
+
+	chartPath := testRenderChart(t)
+	values := &renderValues{set: []string{"image.tag=1.27"}}
+
+	want, err := newSdkRenderer(1).render(context.Background(), chartPath, values)
+	if err != nil {
+		t.Fatalf("sdkRenderer.render() error = %v", err)
+	}
+
+	got, err := (&execRenderer{}).render(context.Background(), chartPath, values)
+	if err != nil {
+		t.Fatalf("execRenderer.render() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(imageSources(t, got), imageSources(t, want)) {
+		t.Errorf("execRenderer.render() images = %v, want %v", imageSources(t, got), imageSources(t, want))
+	}
+}
+
+func TestSplitManifest(t *testing.T) {
+	manifest := `---
+# Source: web/templates/service.yaml
+kind: Service
+---
+# Source: web/templates/pods.yaml
+kind: Pod
+metadata:
+  name: first
+---
+# Source: web/templates/pods.yaml
+kind: Pod
+metadata:
+  name: second
+---
+
+---
+kind: ConfigMap
+`
+
+	want := []renderedTemplate{
+		{Name: "web/templates/service.yaml", Manifest: "# Source: web/templates/service.yaml\nkind: Service\n"},
+		{
+			Name:     "web/templates/pods.yaml",
+			Manifest: "# Source: web/templates/pods.yaml\nkind: Pod\nmetadata:\n  name: first\n---\n# Source: web/templates/pods.yaml\nkind: Pod\nmetadata:\n  name: second\n",
+		},
+		{Manifest: "kind: ConfigMap\n"},
+	}
+
+	if got := splitManifest(manifest); !reflect.DeepEqual(got, want) {
+		t.Errorf("splitManifest() = %+v, want %+v", got, want)
+	}
+}
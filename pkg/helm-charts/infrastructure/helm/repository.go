@@ -0,0 +1,138 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/application/helpers"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// repositoryIndex mirrors the parts of a chart repository index.yaml that we use
+type repositoryIndex struct {
+	Entries map[string][]*chartVersion `yaml:"entries"`
+}
+
+// chartVersion is a single chart release listed in a repository index
+type chartVersion struct {
+	Name    string   `yaml:"name"`
+	Version string   `yaml:"version"`
+	Digest  string   `yaml:"digest"`
+	URLs    []string `yaml:"urls"`
+}
+
+// fetchRepositoryIndex downloads and parses the index.yaml of a chart repository, failing with
+// errIndexTooLarge when it is larger than the index size limit.
+func (s *Service) fetchRepositoryIndex(ctx context.Context, repoURL string) (*repositoryIndex, error) {
+	indexURL, err := url.JoinPath(repoURL, "index.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository URL: %w", err)
+	}
+
+	resp, err := s.httpGet(ctx, indexURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download repository index: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	content, err := readAllLimited(resp.Body, s.limits.MaxIndexSize, errIndexTooLarge)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download repository index: %w", err)
+	}
+
+	index := &repositoryIndex{}
+
+	if err := yaml.Unmarshal(content, index); err != nil {
+		return nil, fmt.Errorf("failed to parse repository index: %w", err)
+	}
+
+	return index, nil
+}
+
+// selectChartVersion picks the highest version of chart in the index that satisfies the constraint.
+// An empty constraint selects the latest stable release.
+func selectChartVersion(index *repositoryIndex, chart, constraint string) (*chartVersion, error) {
+	if constraint == "" {
+		constraint = "*"
+	}
+
+	constraints, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version constraint %q: %w", constraint, err)
+	}
+
+	var (
+		selected        *chartVersion
+		selectedVersion *semver.Version
+	)
+
+	for _, entry := range index.Entries[chart] {
+		version, err := semver.NewVersion(entry.Version)
+		if err != nil {
+			continue
+		}
+
+		if !constraints.Check(version) {
+			continue
+		}
+
+		if selectedVersion == nil || version.GreaterThan(selectedVersion) {
+			selected, selectedVersion = entry, version
+		}
+	}
+
+	if selected == nil {
+		return nil, fmt.Errorf("no version of chart %s matches %q", chart, constraint)
+	}
+
+	if len(selected.URLs) == 0 {
+		return nil, fmt.Errorf("chart %s %s has no download URL", chart, selected.Version)
+	}
+
+	return selected, nil
+}
+
+// resolveChartURL turns a possibly relative chart URL from an index into an absolute, trusted URL.
+func resolveChartURL(repoURL, chartURL string) (string, error) {
+	base, err := url.Parse(strings.TrimSuffix(repoURL, "/") + "/")
+	if err != nil {
+		return "", fmt.Errorf("invalid repository URL: %w", err)
+	}
+
+	ref, err := url.Parse(chartURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid chart URL: %w", err)
+	}
+
+	return helpers.ValidateURL(base.ResolveReference(ref).String())
+}
+
+// resolveChart looks up a chart in a repository index and returns the release to download.
+func (s *Service) resolveChart(ctx context.Context, repoURL, chart, constraint string) (*domain.ChartDetails, error) {
+	index, err := s.fetchRepositoryIndex(ctx, repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := selectChartVersion(index, chart, constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	chartURL, err := resolveChartURL(repoURL, entry.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.ChartDetails{
+		URL:     chartURL,
+		Name:    chart,
+		Version: entry.Version,
+		Digest:  entry.Digest,
+	}, nil
+}
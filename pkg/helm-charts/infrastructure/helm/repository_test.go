@@ -0,0 +1,275 @@
+package helm
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+const testRepositoryIndex = `apiVersion: v1
+entries:
+  redis:
+    - name: redis
+      version: 20.7.0-rc.1
+      digest: 1111111111111111111111111111111111111111111111111111111111111111
+      urls:
+        - https://charts.bitnami.com/bitnami/redis-20.7.0-rc.1.tgz
+    - name: redis
+      version: 20.6.1
+      digest: 2222222222222222222222222222222222222222222222222222222222222222
+      urls:
+        - redis-20.6.1.tgz
+    - name: redis
+      version: 20.6.0
+      digest: 3333333333333333333333333333333333333333333333333333333333333333
+      urls:
+        - https://charts.bitnami.com/bitnami/redis-20.6.0.tgz
+    - name: redis
+      version: 19.0.0
+      urls:
+        - https://evil.example.com/redis-19.0.0.tgz
+  nourls:
+    - name: nourls
+      version: 1.0.0
+`
+
+func TestSelectChartVersion(t *testing.T) {
+	index := &repositoryIndex{
+		Entries: map[string][]*chartVersion{
+			"redis": {
+				{Name: "redis", Version: "20.7.0-rc.1", URLs: []string{"redis-20.7.0-rc.1.tgz"}},
+				{Name: "redis", Version: "20.6.1", URLs: []string{"redis-20.6.1.tgz"}},
+				{Name: "redis", Version: "20.6.0", URLs: []string{"redis-20.6.0.tgz"}},
+				{Name: "redis", Version: "not-semver", URLs: []string{"redis-broken.tgz"}},
+				{Name: "redis", Version: "19.0.0", URLs: []string{"redis-19.0.0.tgz"}},
+			},
+			"nourls": {
+				{Name: "nourls", Version: "1.0.0"},
+			},
+		},
+	}
+
+	type args struct {
+		chart      string
+		constraint string
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "success: latest stable version",
+			args: args{
+				chart: "redis",
+			},
+			want:    "20.6.1",
+			wantErr: false,
+		},
+		{
+			name: "success: tilde constraint",
+			args: args{
+				chart:      "redis",
+				constraint: "~19",
+			},
+			want:    "19.0.0",
+			wantErr: false,
+		},
+		{
+			name: "success: exact version",
+			args: args{
+				chart:      "redis",
+				constraint: "20.6.0",
+			},
+			want:    "20.6.0",
+			wantErr: false,
+		},
+		{
+			name: "success: prerelease constraint",
+			args: args{
+				chart:      "redis",
+				constraint: ">=20.7.0-0",
+			},
+			want:    "20.7.0-rc.1",
+			wantErr: false,
+		},
+		{
+			name: "fail: invalid constraint",
+			args: args{
+				chart:      "redis",
+				constraint: "not a constraint",
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: no matching version",
+			args: args{
+				chart:      "redis",
+				constraint: "^21",
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: unknown chart",
+			args: args{
+				chart: "postgresql",
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: chart without urls",
+			args: args{
+				chart: "nourls",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectChartVersion(index, tt.args.chart, tt.args.constraint)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("selectChartVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && got.Version != tt.want {
+				t.Errorf("selectChartVersion() = %v, want %v", got.Version, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_resolveChart(t *testing.T) {
+	type args struct {
+		repoURL    string
+		chart      string
+		constraint string
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		want    *domain.ChartDetails
+		wantErr bool
+	}{
+		{
+			name: "success: resolve relative chart url",
+			args: args{
+				repoURL:    "https://charts.bitnami.com/bitnami",
+				chart:      "redis",
+				constraint: "~20.6",
+			},
+			want: &domain.ChartDetails{
+				URL:     "https://charts.bitnami.com/bitnami/redis-20.6.1.tgz",
+				Name:    "redis",
+				Version: "20.6.1",
+				Digest:  "2222222222222222222222222222222222222222222222222222222222222222",
+			},
+			wantErr: false,
+		},
+		{
+			name: "success: resolve absolute chart url",
+			args: args{
+				repoURL:    "https://charts.bitnami.com/bitnami/",
+				chart:      "redis",
+				constraint: "20.6.0",
+			},
+			want: &domain.ChartDetails{
+				URL:     "https://charts.bitnami.com/bitnami/redis-20.6.0.tgz",
+				Name:    "redis",
+				Version: "20.6.0",
+				Digest:  "3333333333333333333333333333333333333333333333333333333333333333",
+			},
+			wantErr: false,
+		},
+		{
+			name: "fail: chart url on untrusted domain",
+			args: args{
+				repoURL:    "https://charts.bitnami.com/bitnami",
+				chart:      "redis",
+				constraint: "19.0.0",
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: repository index not found",
+			args: args{
+				repoURL: "https://charts.bitnami.com/missing",
+				chart:   "redis",
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: invalid repository index",
+			args: args{
+				repoURL: "https://charts.bitnami.com/broken",
+				chart:   "redis",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger)
+
+			httpmock.ActivateNonDefault(s.httpClient)
+			defer httpmock.DeactivateAndReset()
+
+			httpmock.RegisterResponder(http.MethodGet, "https://charts.bitnami.com/bitnami/index.yaml",
+				httpmock.NewStringResponder(http.StatusOK, testRepositoryIndex))
+			httpmock.RegisterResponder(http.MethodGet, "https://charts.bitnami.com/missing/index.yaml",
+				httpmock.NewStringResponder(http.StatusNotFound, ""))
+			httpmock.RegisterResponder(http.MethodGet, "https://charts.bitnami.com/broken/index.yaml",
+				httpmock.NewStringResponder(http.StatusOK, "entries: [not: a map"))
+
+			got, err := s.resolveChart(context.Background(), tt.args.repoURL, tt.args.chart, tt.args.constraint)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Service.resolveChart() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if *got != *tt.want {
+				t.Errorf("Service.resolveChart() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_ProcessHelmChart_digestMismatch(t *testing.T) {
+	logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+	s := NewHelmService(logger)
+
+	httpmock.ActivateNonDefault(s.httpClient)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodGet, "https://charts.bitnami.com/bitnami/index.yaml",
+		httpmock.NewStringResponder(http.StatusOK, testRepositoryIndex))
+	httpmock.RegisterResponder(http.MethodGet, "https://charts.bitnami.com/bitnami/redis-20.6.1.tgz",
+		httpmock.NewBytesResponder(http.StatusOK, buildChartArchive(t, map[string]string{
+			"redis/Chart.yaml": "apiVersion: v2\nname: redis\nversion: 20.6.1\n",
+		})))
+
+	_, err := s.ProcessHelmChart(context.Background(), &domain.HelmLinkInput{
+		RepoURL: "https://charts.bitnami.com/bitnami",
+		Chart:   "redis",
+		Version: "20.6.1",
+	})
+	if err == nil {
+		t.Errorf("Service.ProcessHelmChart() expected digest mismatch error")
+	}
+}
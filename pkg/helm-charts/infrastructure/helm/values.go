@@ -0,0 +1,184 @@
+package helm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// renderValues holds the values files and overrides passed to helm template
+type renderValues struct {
+	files []string
+	set   []string
+}
+
+// args returns the helm template flags for the values.
+func (v *renderValues) args() []string {
+	var args []string
+
+	for _, file := range v.files {
+		args = append(args, "--values", file)
+	}
+
+	for _, set := range v.set {
+		args = append(args, "--set", set)
+	}
+
+	return args
+}
+
+// digest returns a hex encoded SHA-256 digest identifying the content of the values files
+// and the overrides, in the order helm applies them.
+func (v *renderValues) digest() (string, error) {
+	hash := sha256.New()
+
+	for _, file := range v.files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read values file: %w", err)
+		}
+
+		fmt.Fprintf(hash, "values %d\n", len(content))
+		hash.Write(content)
+	}
+
+	for _, set := range v.set {
+		fmt.Fprintf(hash, "set %d\n%s", len(set), set)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// cleanup removes the temporary values files.
+func (v *renderValues) cleanup() {
+	for _, file := range v.files {
+		os.Remove(file)
+	}
+}
+
+// inlineValues converts user supplied values, either an object or a YAML document, into YAML.
+func inlineValues(values interface{}) ([]byte, error) {
+	if document, ok := values.(string); ok {
+		parsed := map[string]interface{}{}
+
+		err := yaml.Unmarshal([]byte(document), &parsed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid values: %w", err)
+		}
+
+		values = parsed
+	}
+
+	if _, ok := values.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("invalid values: expected an object")
+	}
+
+	return yaml.Marshal(values)
+}
+
+// writeValuesFile stores a values document in a temporary file and returns its path.
+func writeValuesFile(content []byte) (string, error) {
+	tmpFile, err := os.CreateTemp("", "helm-values-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	defer tmpFile.Close()
+
+	_, err = tmpFile.Write(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to write values to file: %w", err)
+	}
+
+	return tmpFile.Name(), nil
+}
+
+// downloadValuesFile downloads a values file and saves it locally.
+func (s *Service) downloadValuesFile(ctx context.Context, url string) (string, error) {
+	resp, err := s.httpGet(ctx, url)
+	if err != nil {
+		return "", fmt.Errorf("failed to download values file: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	document, err := readAllLimited(resp.Body, s.limits.MaxArchiveSize, errArchiveTooLarge)
+	if err != nil {
+		return "", fmt.Errorf("failed to download values file: %w", err)
+	}
+
+	content := map[string]interface{}{}
+
+	err = yaml.Unmarshal(document, &content)
+	if err != nil {
+		return "", fmt.Errorf("invalid values file %s: %w", url, err)
+	}
+
+	values, err := yaml.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+
+	return writeValuesFile(values)
+}
+
+// prepareValues collects the values files and --set overrides requested for rendering.
+// The returned values must be cleaned up once rendering is done.
+func (s *Service) prepareValues(ctx context.Context, options *domain.RenderOptions) (*renderValues, error) {
+	values := &renderValues{}
+
+	if options == nil {
+		return values, nil
+	}
+
+	for _, url := range options.ValuesURLs {
+		file, err := s.downloadValuesFile(ctx, url)
+		if err != nil {
+			values.cleanup()
+
+			return nil, err
+		}
+
+		values.files = append(values.files, file)
+	}
+
+	if options.Values != nil {
+		content, err := inlineValues(options.Values)
+		if err != nil {
+			values.cleanup()
+
+			return nil, err
+		}
+
+		file, err := writeValuesFile(content)
+		if err != nil {
+			values.cleanup()
+
+			return nil, err
+		}
+
+		values.files = append(values.files, file)
+	}
+
+	keys := make([]string, 0, len(options.Set))
+	for key := range options.Set {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		// helm splits --set on unescaped commas, so keep each value intact
+		value := strings.ReplaceAll(options.Set[key], ",", `\,`)
+		values.set = append(values.set, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	return values, nil
+}
@@ -0,0 +1,187 @@
+package helm
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"gopkg.in/yaml.v3"
+)
+
+func TestInlineValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  interface{}
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "success: json object",
+			values: map[string]interface{}{
+				"metrics": map[string]interface{}{"enabled": true},
+			},
+			want: map[string]interface{}{
+				"metrics": map[string]interface{}{"enabled": true},
+			},
+			wantErr: false,
+		},
+		{
+			name:   "success: yaml document",
+			values: "image:\n  registry: harbor.internal\n",
+			want: map[string]interface{}{
+				"image": map[string]interface{}{"registry": "harbor.internal"},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "fail: invalid yaml document",
+			values:  "image: [registry",
+			wantErr: true,
+		},
+		{
+			name:    "fail: values are not an object",
+			values:  []interface{}{"a", "b"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := inlineValues(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("inlineValues() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			got := map[string]interface{}{}
+
+			if err := yaml.Unmarshal(content, &got); err != nil {
+				t.Errorf("inlineValues() returned invalid yaml: %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inlineValues() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_prepareValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   *domain.RenderOptions
+		wantFiles []string
+		wantSet   []string
+		wantErr   bool
+	}{
+		{
+			name:    "success: no options",
+			options: nil,
+			wantErr: false,
+		},
+		{
+			name: "success: values urls, inline values and overrides",
+			options: &domain.RenderOptions{
+				ValuesURLs: []string{"https://charts.bitnami.com/values/production.yaml"},
+				Values:     map[string]interface{}{"replicaCount": 2},
+				Set: map[string]string{
+					"metrics.enabled":   "true",
+					"image.registry":    "harbor.internal",
+					"extraArgs.exclude": "a,b",
+				},
+			},
+			wantFiles: []string{
+				"replicaCount: 3\n",
+				"replicaCount: 2\n",
+			},
+			wantSet: []string{
+				`extraArgs.exclude=a\,b`,
+				"image.registry=harbor.internal",
+				"metrics.enabled=true",
+			},
+			wantErr: false,
+		},
+		{
+			name: "fail: values url not found",
+			options: &domain.RenderOptions{
+				ValuesURLs: []string{"https://charts.bitnami.com/values/missing.yaml"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: values url is not yaml",
+			options: &domain.RenderOptions{
+				ValuesURLs: []string{"https://charts.bitnami.com/values/broken.yaml"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: invalid inline values",
+			options: &domain.RenderOptions{
+				Values: 42,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
+
+			s := NewHelmService(logger)
+
+			httpmock.ActivateNonDefault(s.httpClient)
+			defer httpmock.DeactivateAndReset()
+
+			httpmock.RegisterResponder(http.MethodGet, "https://charts.bitnami.com/values/production.yaml",
+				httpmock.NewStringResponder(http.StatusOK, "replicaCount: 3\n"))
+			httpmock.RegisterResponder(http.MethodGet, "https://charts.bitnami.com/values/missing.yaml",
+				httpmock.NewStringResponder(http.StatusNotFound, ""))
+			httpmock.RegisterResponder(http.MethodGet, "https://charts.bitnami.com/values/broken.yaml",
+				httpmock.NewStringResponder(http.StatusOK, "<html></html>"))
+
+			values, err := s.prepareValues(context.Background(), tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Service.prepareValues() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			defer values.cleanup()
+
+			if len(values.files) != len(tt.wantFiles) {
+				t.Errorf("Service.prepareValues() files = %v, want %d files", values.files, len(tt.wantFiles))
+				return
+			}
+
+			for i, file := range values.files {
+				content, err := os.ReadFile(file)
+				if err != nil {
+					t.Errorf("failed to read values file: %v", err)
+					return
+				}
+
+				if string(content) != tt.wantFiles[i] {
+					t.Errorf("values file %d = %q, want %q", i, content, tt.wantFiles[i])
+				}
+			}
+
+			if !reflect.DeepEqual(values.set, tt.wantSet) {
+				t.Errorf("Service.prepareValues() set = %v, want %v", values.set, tt.wantSet)
+			}
+		})
+	}
+}
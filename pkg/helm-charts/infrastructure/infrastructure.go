@@ -2,13 +2,18 @@ package infrastructure
 
 import (
 	"context"
+	"io"
 
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
 )
 
 // Helm is the interface for methods exposed from infrastructure
 type Helm interface {
-	ProcessHelmChart(ctx context.Context, path string) ([]*domain.ImageDetails, error)
+	ProcessHelmChart(ctx context.Context, input *domain.HelmLinkInput) (*domain.ChartScanResult, error)
+	ProcessHelmChartArchive(ctx context.Context, archive io.Reader) (*domain.ChartScanResult, error)
+	ProcessHelmChartBatch(ctx context.Context, inputs []*domain.HelmLinkInput) []*domain.BatchChartResult
+	PurgeImageCache(ctx context.Context, image string) (*domain.CachePurgeResult, error)
+	PurgeChartCache(ctx context.Context) (*domain.CachePurgeResult, error)
 }
 
 // Infrastructure implements the infrastructure interface(s)
@@ -2,15 +2,19 @@ package presentation
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/application/common"
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/application/helpers"
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/infrastructure"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/infrastructure/cache"
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/infrastructure/helm"
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/presentation/rest"
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/usecases"
@@ -20,6 +24,14 @@ import (
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
+const (
+	// defaultMaxUploadSize caps uploaded chart archives when MAX_UPLOAD_SIZE is not set
+	defaultMaxUploadSize = 10 << 20
+
+	// defaultCacheMemoryEntries is the number of cache entries kept in memory when CACHE_MEMORY_ENTRIES is not set
+	defaultCacheMemoryEntries = 1024
+)
+
 var allowedOriginPatterns = []string{
 	`^https://.+\.web\.app$`,
 }
@@ -47,15 +59,233 @@ func isAllowedOrigin(origin string, compiledPatterns []*regexp.Regexp) bool {
 	return false
 }
 
+// openCache opens the image and chart cache at CACHE_PATH, returning nil when caching is not configured
+func openCache() (*cache.Cache, error) {
+	path := os.Getenv(common.CachePath.String())
+	if path == "" {
+		return nil, nil
+	}
+
+	memoryEntries, err := helpers.GetIntEnvVar(common.CacheMemoryEntries.String(), defaultCacheMemoryEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	return cache.Open(path, int(memoryEntries))
+}
+
+// helmServiceOptions configures the helm service from the optional environment variables
+func helmServiceOptions(serviceCache *cache.Cache) ([]helm.Option, error) {
+	lookupConcurrency, err := helpers.GetIntEnvVar(common.LookupConcurrency.String(), helm.DefaultLookupConcurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	lookupTimeout, err := helpers.GetIntEnvVar(common.LookupTimeout.String(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	batchConcurrency, err := helpers.GetIntEnvVar(common.BatchConcurrency.String(), helm.DefaultBatchConcurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRedirects, err := helpers.GetIntEnvVar(common.MaxRedirects.String(), helm.DefaultMaxRedirects)
+	if err != nil {
+		return nil, err
+	}
+
+	allowedNetworks, err := helm.ParseNetworks(os.Getenv(common.AllowedNetworks.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	downloadTimeout, err := helpers.GetIntEnvVar(common.DownloadTimeout.String(), int64(helm.DefaultDownloadTimeout/time.Second))
+	if err != nil {
+		return nil, err
+	}
+
+	maxArchiveSize, err := helpers.GetIntEnvVar(common.MaxArchiveSize.String(), helm.DefaultMaxArchiveSize)
+	if err != nil {
+		return nil, err
+	}
+
+	maxDecompressedSize, err := helpers.GetIntEnvVar(common.MaxDecompressedSize.String(), helm.DefaultMaxDecompressedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	maxArchiveFiles, err := helpers.GetIntEnvVar(common.MaxArchiveFiles.String(), helm.DefaultMaxArchiveFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	maxIndexSize, err := helpers.GetIntEnvVar(common.MaxIndexSize.String(), helm.DefaultMaxIndexSize)
+	if err != nil {
+		return nil, err
+	}
+
+	renderConcurrency, err := helpers.GetIntEnvVar(common.RenderConcurrency.String(), helm.DefaultRenderConcurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []helm.Option{
+		helm.WithLookupConcurrency(int(lookupConcurrency)),
+		helm.WithLookupTimeout(time.Duration(lookupTimeout) * time.Second),
+		helm.WithBatchConcurrency(int(batchConcurrency)),
+		helm.WithMaxRedirects(int(maxRedirects)),
+		helm.WithAllowedNetworks(allowedNetworks),
+		helm.WithDownloadTimeout(time.Duration(downloadTimeout) * time.Second),
+		helm.WithRenderConcurrency(int(renderConcurrency)),
+		helm.WithArchiveLimits(helm.ArchiveLimits{
+			MaxArchiveSize:      maxArchiveSize,
+			MaxDecompressedSize: maxDecompressedSize,
+			MaxFiles:            int(maxArchiveFiles),
+			MaxIndexSize:        maxIndexSize,
+		}),
+	}
+
+	switch renderer := os.Getenv(common.HelmRenderer.String()); renderer {
+	case "", "sdk":
+	case "exec":
+		options = append(options, helm.WithExecRenderer())
+	default:
+		return nil, fmt.Errorf("invalid %s %q: expected sdk or exec", common.HelmRenderer, renderer)
+	}
+
+	if serviceCache != nil {
+		tagTTL, err := helpers.GetIntEnvVar(common.CacheTagTTL.String(), int64(helm.DefaultTagTTL/time.Second))
+		if err != nil {
+			return nil, err
+		}
+
+		chartTTL, err := helpers.GetIntEnvVar(common.ChartCacheTTL.String(), int64(helm.DefaultChartCacheTTL/time.Second))
+		if err != nil {
+			return nil, err
+		}
+
+		chartMaxSize, err := helpers.GetIntEnvVar(common.ChartCacheMaxSize.String(), helm.DefaultChartCacheMaxSize)
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options,
+			helm.WithImageCache(serviceCache, time.Duration(tagTTL)*time.Second),
+			helm.WithChartCache(serviceCache, time.Duration(chartTTL)*time.Second, chartMaxSize),
+		)
+	}
+
+	if path := os.Getenv(common.RegistryConfig.String()); path != "" {
+		config, err := helm.LoadRegistryConfig(path)
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options, helm.WithRegistryConfig(config))
+	}
+
+	return options, nil
+}
+
+// loadSourcePolicy loads the trusted chart sources from the file in TRUSTED_SOURCES, falling back to the defaults
+func loadSourcePolicy() (*helpers.SourcePolicy, error) {
+	path := os.Getenv(common.TrustedSources.String())
+	if path == "" {
+		return helpers.DefaultSourcePolicy(), nil
+	}
+
+	return helpers.LoadSourcePolicy(path)
+}
+
+// usecaseServiceOptions configures the usecases from the optional environment variables
+func usecaseServiceOptions() ([]usecases.Option, error) {
+	concurrency, err := helpers.GetIntEnvVar(common.ScanConcurrency.String(), usecases.DefaultScanConcurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	retention, err := helpers.GetIntEnvVar(common.ScanRetention.String(), int64(usecases.DefaultScanRetention/time.Second))
+	if err != nil {
+		return nil, err
+	}
+
+	maxQueuedScans, err := helpers.GetIntEnvVar(common.MaxQueuedScans.String(), usecases.DefaultMaxQueuedScans)
+	if err != nil {
+		return nil, err
+	}
+
+	maxBatchSize, err := helpers.GetIntEnvVar(common.MaxBatchSize.String(), usecases.DefaultMaxBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return []usecases.Option{
+		usecases.WithScanQueue(int(concurrency), time.Duration(retention)*time.Second),
+		usecases.WithMaxQueuedScans(int(maxQueuedScans)),
+		usecases.WithMaxBatchSize(int(maxBatchSize)),
+	}, nil
+}
+
+// requireAdminToken only lets through requests carrying the ADMIN_TOKEN as a bearer token.
+// Admin endpoints are disabled when no token is configured.
+func requireAdminToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin endpoints are disabled"})
+
+			return
+		}
+
+		provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // StartServer sets up gin
 func StartServer(_ context.Context, port int) error {
 	logger := log.New(log.Writer(), "HelmService: ", log.LstdFlags)
 
-	helm := helm.NewHelmService(logger)
+	sourcePolicy, err := loadSourcePolicy()
+	if err != nil {
+		return err
+	}
+
+	helpers.SetSourcePolicy(sourcePolicy)
+
+	logger.Printf("Trusted chart sources: %s", sourcePolicy)
+
+	serviceCache, err := openCache()
+	if err != nil {
+		return err
+	}
+
+	if serviceCache != nil {
+		defer serviceCache.Close()
+	}
+
+	helmOptions, err := helmServiceOptions(serviceCache)
+	if err != nil {
+		return err
+	}
+
+	helm := helm.NewHelmService(logger, helmOptions...)
 
 	infra := infrastructure.NewInfrastructureInteractor(helm)
 
-	usecases := usecases.NewUsecaseHelmImpl(*infra)
+	usecaseOptions, err := usecaseServiceOptions()
+	if err != nil {
+		return err
+	}
+
+	usecases := usecases.NewUsecaseHelmImpl(*infra, usecaseOptions...)
 
 	r := gin.Default()
 
@@ -107,7 +337,12 @@ func SetupRoutes(r *gin.Engine, usecases *usecases.UsecaseHelmService) {
 		log.Panic(err)
 	}
 
-	handlers := rest.NewHandlersInterfaces(usecases)
+	maxUploadSize, err := helpers.GetIntEnvVar(common.MaxUploadSize.String(), defaultMaxUploadSize)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	handlers := rest.NewHandlersInterfaces(usecases, maxUploadSize)
 
 	r.Use(otelgin.Middleware(fmt.Sprintf("helm-chart-%v", environment)))
 
@@ -117,4 +352,21 @@ func SetupRoutes(r *gin.Engine, usecases *usecases.UsecaseHelmService) {
 
 	// endpoints
 	apiV1routes.POST("/helm-link", handlers.ParseHelmLink)
+	apiV1routes.POST("/helm-link/stream", handlers.StreamHelmLink)
+	apiV1routes.POST("/helm-upload", handlers.ParseHelmUpload)
+	apiV1routes.POST("/helm-links/batch", handlers.ParseHelmLinkBatch)
+	apiV1routes.POST("/helm-links/compare", handlers.CompareHelmLinks)
+
+	apiV1routes.POST("/scans", handlers.SubmitScan)
+	apiV1routes.GET("/scans/:id", handlers.GetScan)
+	apiV1routes.DELETE("/scans/:id", handlers.CancelScan)
+
+	adminRoutes := apiV1routes.Group("admin", requireAdminToken(os.Getenv(common.AdminToken.String())))
+
+	adminRoutes.DELETE("/cache/images", handlers.PurgeImageCache)
+	adminRoutes.DELETE("/cache/charts", handlers.PurgeChartCache)
+
+	apiV2routes := r.Group("api/v2")
+
+	apiV2routes.POST("/helm-link", handlers.ParseHelmLinkV2)
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -18,10 +19,16 @@ import (
 
 var testServer *http.Server
 var baseURL string
+var baseURLV2 string
 
-func startTestServer(ctx context.Context, _ *testing.T) {
+// testAdminToken authorizes requests to the admin endpoints of the test server
+const testAdminToken = "test-admin-token"
+
+func startTestServer(ctx context.Context, _ *testing.T, cacheDir string) {
 	port := "8081"
 	os.Setenv(common.Port.String(), port)
+	os.Setenv(common.AdminToken.String(), testAdminToken)
+	os.Setenv(common.CachePath.String(), filepath.Join(cacheDir, "cache.db"))
 
 	go func() {
 		err := presentation.StartServer(ctx, 8081)
@@ -31,6 +38,7 @@ func startTestServer(ctx context.Context, _ *testing.T) {
 	}()
 
 	baseURL = fmt.Sprintf("http://localhost:%s/api/v1", port)
+	baseURLV2 = fmt.Sprintf("http://localhost:%s/api/v2", port)
 }
 
 func stopTestServer(ctx context.Context, t *testing.T) {
@@ -44,8 +52,15 @@ func TestMain(m *testing.M) {
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 	defer cancel()
 
+	cacheDir, err := os.MkdirTemp("", "helm-charts-cache-")
+	if err != nil {
+		log.Panicf("failed to create cache directory: %v", err)
+	}
+
+	defer os.RemoveAll(cacheDir)
+
 	// Start the test server
-	startTestServer(ctx, &testing.T{})
+	startTestServer(ctx, &testing.T{}, cacheDir)
 
 	// Run the tests
 	exitCode := m.Run()
@@ -1,6 +1,8 @@
 package rest
 
 import (
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -8,17 +10,184 @@ import (
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/usecases"
 )
 
+const (
+	// chartFormField is the multipart form field holding an uploaded chart archive
+	chartFormField = "chart"
+
+	// imageQueryParam selects the image whose cache entries are purged
+	imageQueryParam = "image"
+
+	// scanIDParam is the path parameter holding a scan ID
+	scanIDParam = "id"
+)
+
 type HandlersInterfacesImpl struct {
-	usecase *usecases.UsecaseHelmService
+	usecase       *usecases.UsecaseHelmService
+	maxUploadSize int64
 }
 
-func NewHandlersInterfaces(usecases *usecases.UsecaseHelmService) *HandlersInterfacesImpl {
+func NewHandlersInterfaces(usecases *usecases.UsecaseHelmService, maxUploadSize int64) *HandlersInterfacesImpl {
 	return &HandlersInterfacesImpl{
-		usecase: usecases,
+		usecase:       usecases,
+		maxUploadSize: maxUploadSize,
 	}
 }
 
+// ParseHelmLink processes a helm chart and responds with its images only, the response of the
+// first version of the API. ParseHelmLinkV2 responds with the whole scan result.
 func (h HandlersInterfacesImpl) ParseHelmLink(c *gin.Context) {
+	result, ok := h.processHelmLink(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Images)
+}
+
+// ParseHelmLinkV2 processes a helm chart and responds with the scan result, including the chart
+// that was resolved, the scan summary and the images.
+func (h HandlersInterfacesImpl) ParseHelmLinkV2(c *gin.Context) {
+	result, ok := h.processHelmLink(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// processHelmLink binds a helm link request and processes it, aborting the request on failure.
+func (h HandlersInterfacesImpl) processHelmLink(c *gin.Context) (*domain.ChartScanResult, bool) {
+	urlLink := domain.HelmLinkInput{}
+
+	err := c.BindJSON(&urlLink)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return nil, false
+	}
+
+	result, err := h.usecase.ProcessHelmChart(c.Request.Context(), &urlLink)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return nil, false
+	}
+
+	return result, true
+}
+
+// ParseHelmLinkBatch processes several helm charts, each with its own values, in a single request
+func (h HandlersInterfacesImpl) ParseHelmLinkBatch(c *gin.Context) {
+	batch := domain.BatchInput{}
+
+	err := c.BindJSON(&batch)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	result, err := h.usecase.ProcessHelmChartBatch(c.Request.Context(), &batch)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// CompareHelmLinks reports how the images of two helm charts, typically two versions of a chart, differ
+func (h HandlersInterfacesImpl) CompareHelmLinks(c *gin.Context) {
+	compare := domain.CompareInput{}
+
+	err := c.BindJSON(&compare)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	result, err := h.usecase.CompareHelmCharts(c.Request.Context(), &compare)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// StreamHelmLink processes a helm chart like ParseHelmLink, streaming its progress as
+// server-sent events named after the event type. The stream ends with a completed or failed event.
+func (h HandlersInterfacesImpl) StreamHelmLink(c *gin.Context) {
+	urlLink := domain.HelmLinkInput{}
+
+	err := c.BindJSON(&urlLink)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	events, err := h.usecase.StreamHelmChart(c.Request.Context(), &urlLink)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	c.Stream(func(_ io.Writer) bool {
+		event, ok := <-events
+		if !ok {
+			return false
+		}
+
+		c.SSEvent(string(event.Type), event)
+
+		return true
+	})
+}
+
+// ParseHelmUpload processes a packaged chart uploaded as a multipart form file
+func (h HandlersInterfacesImpl) ParseHelmUpload(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxUploadSize)
+
+	fileHeader, err := c.FormFile(chartFormField)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	archive, err := fileHeader.Open()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	defer archive.Close()
+
+	result, err := h.usecase.ProcessHelmChartArchive(c.Request.Context(), archive)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// SubmitScan queues a chart for scanning in the background and returns the scan to poll
+func (h HandlersInterfacesImpl) SubmitScan(c *gin.Context) {
 	urlLink := domain.HelmLinkInput{}
 
 	err := c.BindJSON(&urlLink)
@@ -28,12 +197,77 @@ func (h HandlersInterfacesImpl) ParseHelmLink(c *gin.Context) {
 		return
 	}
 
-	images, err := h.usecase.ProcessHelmChart(c.Request.Context(), &urlLink)
+	job, err := h.usecase.SubmitScan(c.Request.Context(), &urlLink)
+	if errors.Is(err, usecases.ErrScanQueueFull) {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetScan returns the status, progress and results of a scan
+func (h HandlersInterfacesImpl) GetScan(c *gin.Context) {
+	job, err := h.usecase.GetScan(c.Request.Context(), c.Param(scanIDParam))
+	if err != nil {
+		abortWithScanError(c, err)
+
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelScan cancels a queued or running scan, or removes a finished one
+func (h HandlersInterfacesImpl) CancelScan(c *gin.Context) {
+	job, err := h.usecase.CancelScan(c.Request.Context(), c.Param(scanIDParam))
+	if err != nil {
+		abortWithScanError(c, err)
+
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// abortWithScanError responds with 404 for unknown scans and 400 otherwise
+func abortWithScanError(c *gin.Context, err error) {
+	if errors.Is(err, usecases.ErrScanNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// PurgeImageCache removes cached image details, for the image in the query string or for every image
+func (h HandlersInterfacesImpl) PurgeImageCache(c *gin.Context) {
+	result, err := h.usecase.PurgeImageCache(c.Request.Context(), c.Query(imageQueryParam))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// PurgeChartCache removes every cached chart archive and rendered template
+func (h HandlersInterfacesImpl) PurgeChartCache(c *gin.Context) {
+	result, err := h.usecase.PurgeChartCache(c.Request.Context())
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 
 		return
 	}
 
-	c.JSON(http.StatusOK, images)
+	c.JSON(http.StatusOK, result)
 }
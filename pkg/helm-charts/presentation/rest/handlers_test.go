@@ -1,14 +1,26 @@
 package rest_test
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/infrastructure"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/infrastructure/helm/mock"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/presentation/rest"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/usecases"
 )
 
 func TestHandlersInterfacesImpl_ParseHelmLink(t *testing.T) {
@@ -58,6 +70,7 @@ func TestHandlersInterfacesImpl_ParseHelmLink(t *testing.T) {
 		name       string
 		args       args
 		wantStatus int
+		wantArray  bool
 		wantErr    bool
 	}{
 		{
@@ -68,8 +81,29 @@ func TestHandlersInterfacesImpl_ParseHelmLink(t *testing.T) {
 				body:       bytes.NewBuffer(validPayload),
 			},
 			wantStatus: http.StatusOK,
+			wantArray:  true,
 			wantErr:    false,
 		},
+		{
+			name: "success: get scan result",
+			args: args{
+				url:        fmt.Sprintf("%s/helm-link", baseURLV2),
+				httpMethod: http.MethodPost,
+				body:       bytes.NewBuffer(validPayload),
+			},
+			wantStatus: http.StatusOK,
+			wantErr:    false,
+		},
+		{
+			name: "fail: invalid download, v2",
+			args: args{
+				url:        fmt.Sprintf("%s/helm-link", baseURLV2),
+				httpMethod: http.MethodPost,
+				body:       bytes.NewBuffer(invalidDomainPayload),
+			},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    true,
+		},
 		{
 			name: "fail: fail to bind json",
 			args: args{
@@ -137,6 +171,13 @@ func TestHandlersInterfacesImpl_ParseHelmLink(t *testing.T) {
 				return
 			}
 
+			if !tt.wantErr && resp.StatusCode == http.StatusOK {
+				if isArray := bytes.HasPrefix(bytes.TrimSpace(dataResponse), []byte("[")); isArray != tt.wantArray {
+					t.Errorf("response is an array = %v, want %v", isArray, tt.wantArray)
+					return
+				}
+			}
+
 			data := map[string]interface{}{}
 
 			err = json.Unmarshal(dataResponse, &data)
@@ -168,3 +209,609 @@ func TestHandlersInterfacesImpl_ParseHelmLink(t *testing.T) {
 		})
 	}
 }
+
+// multipartChartBody builds a multipart form with content stored under field
+func multipartChartBody(t *testing.T, field string, content []byte) (*bytes.Buffer, string) {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	part, err := writer.CreateFormFile(field, "chart.tgz")
+	if err != nil {
+		t.Fatalf("failed to create form file: %v", err)
+	}
+
+	if _, err := part.Write(content); err != nil {
+		t.Fatalf("failed to write form file: %v", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close multipart writer: %v", err)
+	}
+
+	return body, writer.FormDataContentType()
+}
+
+// chartArchive packages a minimal chart without any templates
+func chartArchive(t *testing.T) []byte {
+	t.Helper()
+
+	chartYAML := []byte("apiVersion: v2\nname: hello-world\nversion: 0.1.0\n")
+
+	var buf bytes.Buffer
+
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err := tarWriter.WriteHeader(&tar.Header{
+		Name:     "hello-world/Chart.yaml",
+		Mode:     0o644,
+		Size:     int64(len(chartYAML)),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		t.Fatalf("failed to write tar header: %v", err)
+	}
+
+	if _, err := tarWriter.Write(chartYAML); err != nil {
+		t.Fatalf("failed to write Chart.yaml: %v", err)
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestHandlersInterfacesImpl_ParseHelmUpload(t *testing.T) {
+	validBody, validContentType := multipartChartBody(t, "chart", chartArchive(t))
+	wrongFieldBody, wrongFieldContentType := multipartChartBody(t, "file", chartArchive(t))
+	notChartBody, notChartContentType := multipartChartBody(t, "chart", []byte("fake tarball content"))
+	tooLargeBody, tooLargeContentType := multipartChartBody(t, "chart", bytes.Repeat([]byte("a"), 11<<20))
+
+	type args struct {
+		url         string
+		body        io.Reader
+		contentType string
+	}
+
+	tests := []struct {
+		name       string
+		args       args
+		wantStatus int
+		wantErr    bool
+	}{
+		{
+			name: "success: get image data from uploaded chart",
+			args: args{
+				url:         fmt.Sprintf("%s/helm-upload", baseURL),
+				body:        validBody,
+				contentType: validContentType,
+			},
+			wantStatus: http.StatusOK,
+			wantErr:    false,
+		},
+		{
+			name: "fail: chart form field missing",
+			args: args{
+				url:         fmt.Sprintf("%s/helm-upload", baseURL),
+				body:        wrongFieldBody,
+				contentType: wrongFieldContentType,
+			},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    true,
+		},
+		{
+			name: "fail: uploaded file is not a chart",
+			args: args{
+				url:         fmt.Sprintf("%s/helm-upload", baseURL),
+				body:        notChartBody,
+				contentType: notChartContentType,
+			},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    true,
+		},
+		{
+			name: "fail: upload too large",
+			args: args{
+				url:         fmt.Sprintf("%s/helm-upload", baseURL),
+				body:        tooLargeBody,
+				contentType: tooLargeContentType,
+			},
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodPost, tt.args.url, tt.args.body)
+			if err != nil {
+				t.Errorf("unable to compose request: %s", err)
+				return
+			}
+
+			r.Header.Set("Content-Type", tt.args.contentType)
+			r.Close = true
+
+			resp, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Errorf("request error: %s", err)
+				return
+			}
+
+			defer resp.Body.Close()
+
+			data := map[string]interface{}{}
+
+			err = json.NewDecoder(resp.Body).Decode(&data)
+			if err != nil {
+				t.Errorf("bad data returned: %v", err)
+				return
+			}
+
+			_, hasErr := data["error"]
+			if hasErr != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, data)
+				return
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %s", tt.wantStatus, resp.Status)
+				return
+			}
+		})
+	}
+}
+
+func TestHandlersInterfacesImpl_PurgeImageCache(t *testing.T) {
+	type args struct {
+		url   string
+		token string
+	}
+
+	tests := []struct {
+		name       string
+		args       args
+		wantStatus int
+		wantErr    bool
+	}{
+		{
+			name: "success: purge every image",
+			args: args{
+				url:   fmt.Sprintf("%s/admin/cache/images", baseURL),
+				token: testAdminToken,
+			},
+			wantStatus: http.StatusOK,
+			wantErr:    false,
+		},
+		{
+			name: "success: purge one image",
+			args: args{
+				url:   fmt.Sprintf("%s/admin/cache/images?image=nginx:1.16.0", baseURL),
+				token: testAdminToken,
+			},
+			wantStatus: http.StatusOK,
+			wantErr:    false,
+		},
+		{
+			name: "success: purge charts",
+			args: args{
+				url:   fmt.Sprintf("%s/admin/cache/charts", baseURL),
+				token: testAdminToken,
+			},
+			wantStatus: http.StatusOK,
+			wantErr:    false,
+		},
+		{
+			name: "fail: purge charts without admin token",
+			args: args{
+				url: fmt.Sprintf("%s/admin/cache/charts", baseURL),
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantErr:    true,
+		},
+		{
+			name: "fail: invalid image",
+			args: args{
+				url:   fmt.Sprintf("%s/admin/cache/images?image=nginx@latest@v1", baseURL),
+				token: testAdminToken,
+			},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    true,
+		},
+		{
+			name: "fail: missing admin token",
+			args: args{
+				url: fmt.Sprintf("%s/admin/cache/images", baseURL),
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantErr:    true,
+		},
+		{
+			name: "fail: wrong admin token",
+			args: args{
+				url:   fmt.Sprintf("%s/admin/cache/images", baseURL),
+				token: "wrong",
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodDelete, tt.args.url, nil)
+			if err != nil {
+				t.Errorf("unable to compose request: %s", err)
+				return
+			}
+
+			if tt.args.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.args.token)
+			}
+
+			r.Close = true
+
+			resp, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Errorf("request error: %s", err)
+				return
+			}
+
+			defer resp.Body.Close()
+
+			data := map[string]interface{}{}
+
+			err = json.NewDecoder(resp.Body).Decode(&data)
+			if err != nil {
+				t.Errorf("bad data returned: %v", err)
+				return
+			}
+
+			_, hasErr := data["error"]
+			if hasErr != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, data)
+				return
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %s", tt.wantStatus, resp.Status)
+				return
+			}
+		})
+	}
+}
+
+func TestHandlersInterfacesImpl_Scans(t *testing.T) {
+	submit := func(body string) (int, map[string]interface{}) {
+		resp, err := http.Post(fmt.Sprintf("%s/scans", baseURL), "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("request error: %s", err)
+		}
+
+		defer resp.Body.Close()
+
+		data := map[string]interface{}{}
+		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+			t.Fatalf("bad data returned: %v", err)
+		}
+
+		return resp.StatusCode, data
+	}
+
+	status, job := submit(`{"url_link": "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz"}`)
+	if status != http.StatusAccepted || job["status"] != string(domain.ScanStatusQueued) {
+		t.Fatalf("expected a queued scan, got %d %v", status, job)
+	}
+
+	id, _ := job["id"].(string)
+
+	if status, data := submit(`{"url_link": "https://evil.example.com/chart.tgz"}`); status != http.StatusBadRequest {
+		t.Errorf("expected status %d for an untrusted chart, got %d %v", http.StatusBadRequest, status, data)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		id         string
+		wantStatus int
+	}{
+		{
+			name:       "success: get scan",
+			method:     http.MethodGet,
+			id:         id,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "fail: get unknown scan",
+			method:     http.MethodGet,
+			id:         "unknown",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "success: cancel scan",
+			method:     http.MethodDelete,
+			id:         id,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "fail: cancel unknown scan",
+			method:     http.MethodDelete,
+			id:         "unknown",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(tt.method, fmt.Sprintf("%s/scans/%s", baseURL, tt.id), nil)
+			if err != nil {
+				t.Errorf("unable to compose request: %s", err)
+				return
+			}
+
+			r.Close = true
+
+			resp, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Errorf("request error: %s", err)
+				return
+			}
+
+			defer resp.Body.Close()
+
+			data := map[string]interface{}{}
+
+			err = json.NewDecoder(resp.Body).Decode(&data)
+			if err != nil {
+				t.Errorf("bad data returned: %v", err)
+				return
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %s", tt.wantStatus, resp.Status)
+				return
+			}
+
+			if _, hasID := data["id"]; hasID != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("unexpected response %v", data)
+			}
+		})
+	}
+}
+
+func TestHandlersInterfacesImpl_SubmitScan_queueFull(t *testing.T) {
+	fakeHelm := mock.NewHelmServiceMock()
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	defer close(release)
+
+	fakeHelm.MockProcessHelmChartFn = func(ctx context.Context, _ *domain.HelmLinkInput) (*domain.ChartScanResult, error) {
+		started <- struct{}{}
+
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+
+		return &domain.ChartScanResult{}, nil
+	}
+
+	usecase := usecases.NewUsecaseHelmImpl(*infrastructure.NewInfrastructureInteractor(fakeHelm),
+		usecases.WithScanQueue(1, time.Hour), usecases.WithMaxQueuedScans(1))
+
+	router := gin.New()
+	router.POST("/scans", rest.NewHandlersInterfaces(usecase, 1<<20).SubmitScan)
+
+	submit := func() int {
+		body := `{"url_link": "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz"}`
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/scans", strings.NewReader(body)))
+
+		return w.Code
+	}
+
+	if status := submit(); status != http.StatusAccepted {
+		t.Fatalf("expected status %d for the running scan, got %d", http.StatusAccepted, status)
+	}
+
+	<-started
+
+	if status := submit(); status != http.StatusAccepted {
+		t.Fatalf("expected status %d for the queued scan, got %d", http.StatusAccepted, status)
+	}
+
+	if status := submit(); status != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d with a full queue, got %d", http.StatusServiceUnavailable, status)
+	}
+}
+
+func TestHandlersInterfacesImpl_StreamHelmLink(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantStream bool
+	}{
+		{
+			name:       "success: stream scan events",
+			body:       `{"url_link": "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz"}`,
+			wantStatus: http.StatusOK,
+			wantStream: true,
+		},
+		{
+			name:       "fail: untrusted chart",
+			body:       `{"url_link": "https://evil.example.com/chart.tgz"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "fail: invalid json",
+			body:       `{"url_link":`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(fmt.Sprintf("%s/helm-link/stream", baseURL), "application/json", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Errorf("request error: %s", err)
+				return
+			}
+
+			defer resp.Body.Close()
+
+			dataResponse, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Errorf("can't read request body: %s", err)
+				return
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %s", tt.wantStatus, resp.Status)
+				return
+			}
+
+			if !tt.wantStream {
+				data := map[string]interface{}{}
+				if err := json.Unmarshal(dataResponse, &data); err != nil || data["error"] == nil {
+					t.Errorf("expected an error, got %s", dataResponse)
+				}
+
+				return
+			}
+
+			if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+				t.Errorf("expected an event stream, got %s", resp.Header.Get("Content-Type"))
+			}
+
+			completed := fmt.Sprintf("event:%s\n", domain.ScanEventCompleted)
+			failed := fmt.Sprintf("event:%s\n", domain.ScanEventFailed)
+
+			if !strings.Contains(string(dataResponse), completed) && !strings.Contains(string(dataResponse), failed) {
+				t.Errorf("expected the stream to end with a result, got %s", dataResponse)
+			}
+		})
+	}
+}
+
+func TestHandlersInterfacesImpl_ParseHelmLinkBatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCharts int
+	}{
+		{
+			name: "success: per chart results",
+			body: `{"charts": [
+				{"url_link": "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz"},
+				{"url_link": "https://evil.example.com/chart.tgz"}
+			]}`,
+			wantStatus: http.StatusOK,
+			wantCharts: 2,
+		},
+		{
+			name:       "fail: empty batch",
+			body:       `{"charts": []}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "fail: invalid json",
+			body:       `{"charts":`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(fmt.Sprintf("%s/helm-links/batch", baseURL), "application/json", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Errorf("request error: %s", err)
+				return
+			}
+
+			defer resp.Body.Close()
+
+			data := domain.BatchScanResult{}
+
+			if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+				t.Errorf("bad data returned: %v", err)
+				return
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %s", tt.wantStatus, resp.Status)
+				return
+			}
+
+			if len(data.Charts) != tt.wantCharts {
+				t.Errorf("expected %d chart results, got %d", tt.wantCharts, len(data.Charts))
+			}
+
+			if tt.wantCharts > 0 && (data.Summary == nil || data.Summary.Charts != tt.wantCharts || data.Charts[1].Error == "") {
+				t.Errorf("unexpected batch result %+v", data)
+			}
+		})
+	}
+}
+
+func TestHandlersInterfacesImpl_CompareHelmLinks(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name: "fail: untrusted chart",
+			body: `{
+				"old": {"url_link": "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz"},
+				"new": {"url_link": "https://evil.example.com/chart.tgz"}
+			}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "fail: invalid json",
+			body:       `{"old":`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(fmt.Sprintf("%s/helm-links/compare", baseURL), "application/json", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Errorf("request error: %s", err)
+				return
+			}
+
+			defer resp.Body.Close()
+
+			data := map[string]interface{}{}
+
+			if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+				t.Errorf("bad data returned: %v", err)
+				return
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %s", tt.wantStatus, resp.Status)
+				return
+			}
+
+			if _, ok := data["error"]; ok != (tt.wantStatus != http.StatusOK) {
+				t.Errorf("unexpected response %v", data)
+			}
+		})
+	}
+}
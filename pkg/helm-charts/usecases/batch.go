@@ -0,0 +1,106 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// DefaultMaxBatchSize is the number of charts a batch request may scan by default
+const DefaultMaxBatchSize = 100
+
+// ProcessHelmChartBatch scans every chart of the batch, sharing image lookups between charts, and
+// aggregates the unique images across them. Charts with invalid input are reported as failed
+// without failing the rest of the batch.
+func (u *UsecaseHelmService) ProcessHelmChartBatch(ctx context.Context, batch *domain.BatchInput) (*domain.BatchScanResult, error) {
+	ctx, span := tracer.Start(ctx, "ProcessHelmChartBatch")
+	defer span.End()
+
+	if len(batch.Charts) == 0 || len(batch.Charts) > u.maxBatchSize {
+		err := fmt.Errorf("a batch must contain between 1 and %d charts, got %d", u.maxBatchSize, len(batch.Charts))
+
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+
+		return nil, err
+	}
+
+	results := make([]*domain.BatchChartResult, len(batch.Charts))
+
+	var (
+		inputs  []*domain.HelmLinkInput
+		indexes []int
+	)
+
+	for i := range batch.Charts {
+		input, err := validateHelmLinkInput(&batch.Charts[i])
+		if err != nil {
+			results[i] = &domain.BatchChartResult{Index: i, Error: err.Error()}
+
+			continue
+		}
+
+		inputs = append(inputs, input)
+		indexes = append(indexes, i)
+	}
+
+	if len(inputs) > 0 {
+		for i, result := range u.Infrastructure.Helm.ProcessHelmChartBatch(ctx, inputs) {
+			result.Index = indexes[i]
+			results[indexes[i]] = result
+		}
+	}
+
+	return aggregateBatch(results), nil
+}
+
+// aggregateBatch collects the unique images of the charts of a batch, in the order they first appear,
+// and sums the size of those that were looked up successfully.
+func aggregateBatch(results []*domain.BatchChartResult) *domain.BatchScanResult {
+	aggregate := &domain.BatchScanResult{
+		Summary: &domain.BatchSummary{Charts: len(results)},
+		Charts:  results,
+		Images:  []*domain.BatchImage{},
+	}
+
+	byReference := map[string]*domain.BatchImage{}
+
+	for _, result := range results {
+		if result.Result == nil {
+			aggregate.Summary.Failed++
+
+			continue
+		}
+
+		aggregate.Summary.Succeeded++
+
+		for _, details := range result.Result.Images {
+			image, ok := byReference[details.Reference]
+			if !ok {
+				image = &domain.BatchImage{Reference: details.Reference}
+				byReference[details.Reference] = image
+				aggregate.Images = append(aggregate.Images, image)
+			}
+
+			// Keep the first successful lookup, a failed lookup reports no size
+			if image.Status != domain.ImageStatusOK {
+				image.Status = details.Status
+				image.Digest = details.Digest
+				image.Size = details.Size
+				image.Layers = details.Layers
+			}
+
+			image.Charts = append(image.Charts, result.Index)
+		}
+	}
+
+	for _, image := range aggregate.Images {
+		aggregate.Summary.TotalSize += image.Size
+	}
+
+	aggregate.Summary.UniqueImages = len(aggregate.Images)
+
+	return aggregate
+}
@@ -0,0 +1,117 @@
+package usecases_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/usecases"
+)
+
+func TestUsecaseHelmService_ProcessHelmChartBatch(t *testing.T) {
+	nginx := &domain.ImageDetails{Reference: "index.docker.io/library/nginx:1.25", Digest: "sha256:aaa", Status: domain.ImageStatusOK, Size: 100, Layers: 2}
+	redis := &domain.ImageDetails{Reference: "index.docker.io/library/redis:7", Digest: "sha256:bbb", Status: domain.ImageStatusOK, Size: 50, Layers: 1}
+	missing := &domain.ImageDetails{Reference: "index.docker.io/library/missing:1", Status: domain.ImageStatusNotFound, Error: "not found"}
+
+	results := map[string]*domain.ChartScanResult{
+		"https://github.com/example/a.tgz": {Images: []*domain.ImageDetails{nginx, missing}},
+		"https://github.com/example/b.tgz": {Images: []*domain.ImageDetails{nginx, redis}},
+	}
+
+	tests := []struct {
+		name        string
+		charts      []domain.HelmLinkInput
+		wantErr     bool
+		wantSummary domain.BatchSummary
+		wantErrors  []bool
+		wantImages  map[string][]int
+	}{
+		{
+			name: "success: shared images counted once",
+			charts: []domain.HelmLinkInput{
+				{Path: "https://github.com/example/a.tgz"},
+				{Path: "https://github.com/example/b.tgz"},
+			},
+			wantSummary: domain.BatchSummary{Charts: 2, Succeeded: 2, UniqueImages: 3, TotalSize: 150},
+			wantErrors:  []bool{false, false},
+			wantImages: map[string][]int{
+				nginx.Reference:   {0, 1},
+				missing.Reference: {0},
+				redis.Reference:   {1},
+			},
+		},
+		{
+			name: "success: invalid and failed charts reported per chart",
+			charts: []domain.HelmLinkInput{
+				{Path: "https://evil.example.com/chart.tgz"},
+				{Path: "https://github.com/example/b.tgz"},
+				{Path: "https://github.com/example/broken.tgz"},
+			},
+			wantSummary: domain.BatchSummary{Charts: 3, Succeeded: 1, Failed: 2, UniqueImages: 2, TotalSize: 150},
+			wantErrors:  []bool{true, false, true},
+			wantImages: map[string][]int{
+				nginx.Reference: {1},
+				redis.Reference: {1},
+			},
+		},
+		{
+			name:    "fail: empty batch",
+			wantErr: true,
+		},
+		{
+			name:    "fail: batch too large",
+			charts:  make([]domain.HelmLinkInput, 4),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, mock := initializeMocks(usecases.WithMaxBatchSize(3))
+
+			mock.Helm.MockProcessHelmChartBatchFn = func(_ context.Context, inputs []*domain.HelmLinkInput) []*domain.BatchChartResult {
+				batch := make([]*domain.BatchChartResult, len(inputs))
+
+				for i, input := range inputs {
+					batch[i] = &domain.BatchChartResult{Index: i, Result: results[input.Path]}
+					if batch[i].Result == nil {
+						batch[i].Error = fmt.Sprintf("failed to download Helm chart %s", input.Path)
+					}
+				}
+
+				return batch
+			}
+
+			got, err := u.ProcessHelmChartBatch(context.Background(), &domain.BatchInput{Charts: tt.charts})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UsecaseHelmService.ProcessHelmChartBatch() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if *got.Summary != tt.wantSummary {
+				t.Errorf("UsecaseHelmService.ProcessHelmChartBatch() summary = %+v, want %+v", got.Summary, tt.wantSummary)
+			}
+
+			for i, chart := range got.Charts {
+				if chart.Index != i || (chart.Error != "") != tt.wantErrors[i] || (chart.Result == nil) != tt.wantErrors[i] {
+					t.Errorf("UsecaseHelmService.ProcessHelmChartBatch() chart %d = %+v", i, chart)
+				}
+			}
+
+			images := map[string][]int{}
+			for _, image := range got.Images {
+				images[image.Reference] = image.Charts
+			}
+
+			if !reflect.DeepEqual(images, tt.wantImages) {
+				t.Errorf("UsecaseHelmService.ProcessHelmChartBatch() images = %v, want %v", images, tt.wantImages)
+			}
+		})
+	}
+}
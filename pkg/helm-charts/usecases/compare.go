@@ -0,0 +1,184 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// CompareHelmCharts scans both charts, sharing their image lookups, and reports how their images differ.
+func (u *UsecaseHelmService) CompareHelmCharts(ctx context.Context, compare *domain.CompareInput) (*domain.CompareResult, error) {
+	ctx, span := tracer.Start(ctx, "CompareHelmCharts")
+	defer span.End()
+
+	oldInput, err := validateHelmLinkInput(&compare.Old)
+	if err != nil {
+		err = fmt.Errorf("invalid old chart: %w", err)
+
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+
+		return nil, err
+	}
+
+	newInput, err := validateHelmLinkInput(&compare.New)
+	if err != nil {
+		err = fmt.Errorf("invalid new chart: %w", err)
+
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+
+		return nil, err
+	}
+
+	results := u.Infrastructure.Helm.ProcessHelmChartBatch(ctx, []*domain.HelmLinkInput{oldInput, newInput})
+
+	for i, label := range []string{"old", "new"} {
+		if results[i].Error != "" {
+			err := fmt.Errorf("failed to scan %s chart: %s", label, results[i].Error)
+
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+
+			return nil, err
+		}
+	}
+
+	return compareImages(results[0].Result, results[1].Result), nil
+}
+
+// imageRepository strips the tag and digest from a fully qualified image reference.
+func imageRepository(reference string) string {
+	repository, _, _ := strings.Cut(reference, "@")
+
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
+	}
+
+	return repository
+}
+
+// compareImages pairs the images of both charts by repository, preferring images with the same
+// reference, and diffs each pair. Images of the new chart come first, in chart order, followed by
+// the images that were removed.
+func compareImages(oldResult, newResult *domain.ChartScanResult) *domain.CompareResult {
+	result := &domain.CompareResult{
+		Old:     oldResult.Chart,
+		New:     newResult.Chart,
+		Summary: &domain.CompareSummary{},
+		Images:  []*domain.ImageDiff{},
+	}
+
+	unmatched := map[string][]*domain.ImageDetails{}
+
+	for _, image := range oldResult.Images {
+		repository := imageRepository(image.Reference)
+		unmatched[repository] = append(unmatched[repository], image)
+		result.Summary.OldSize += image.Size
+	}
+
+	for _, image := range newResult.Images {
+		repository := imageRepository(image.Reference)
+		candidates := unmatched[repository]
+
+		match := slices.IndexFunc(candidates, func(candidate *domain.ImageDetails) bool {
+			return candidate.Reference == image.Reference
+		})
+
+		if match < 0 && len(candidates) > 0 {
+			match = 0
+		}
+
+		var previous *domain.ImageDetails
+
+		if match >= 0 {
+			previous = candidates[match]
+			unmatched[repository] = slices.Delete(candidates, match, match+1)
+		}
+
+		result.Images = append(result.Images, diffImage(repository, previous, image))
+		result.Summary.NewSize += image.Size
+	}
+
+	for _, image := range oldResult.Images {
+		repository := imageRepository(image.Reference)
+
+		if slices.Contains(unmatched[repository], image) {
+			result.Images = append(result.Images, diffImage(repository, image, nil))
+		}
+	}
+
+	for _, diff := range result.Images {
+		switch diff.Change {
+		case domain.ImageChangeAdded:
+			result.Summary.Added++
+		case domain.ImageChangeRemoved:
+			result.Summary.Removed++
+		case domain.ImageChangeChanged:
+			result.Summary.Changed++
+		case domain.ImageChangeUnchanged:
+			result.Summary.Unchanged++
+		}
+	}
+
+	result.Summary.SizeDelta = result.Summary.NewSize - result.Summary.OldSize
+
+	return result
+}
+
+// diffImage compares the old and new image of a repository, either of which may be missing.
+// Images whose digest is unknown because their lookup failed are compared by reference only.
+func diffImage(repository string, oldImage, newImage *domain.ImageDetails) *domain.ImageDiff {
+	diff := &domain.ImageDiff{Repository: repository}
+
+	if oldImage != nil {
+		diff.OldReference = oldImage.Reference
+		diff.OldDigest = oldImage.Digest
+		diff.OldSize = oldImage.Size
+		diff.OldLayers = oldImage.Layers
+	}
+
+	if newImage != nil {
+		diff.NewReference = newImage.Reference
+		diff.NewDigest = newImage.Digest
+		diff.NewSize = newImage.Size
+		diff.NewLayers = newImage.Layers
+	}
+
+	diff.SizeDelta = diff.NewSize - diff.OldSize
+	diff.LayersDelta = diff.NewLayers - diff.OldLayers
+
+	switch {
+	case oldImage == nil:
+		diff.Change = domain.ImageChangeAdded
+
+		return diff
+	case newImage == nil:
+		diff.Change = domain.ImageChangeRemoved
+
+		return diff
+	case oldImage.Reference == newImage.Reference &&
+		(oldImage.Digest == newImage.Digest || oldImage.Digest == "" || newImage.Digest == ""):
+		diff.Change = domain.ImageChangeUnchanged
+	default:
+		diff.Change = domain.ImageChangeChanged
+	}
+
+	oldLayers := map[string]bool{}
+	for _, layer := range oldImage.LayerDetails {
+		oldLayers[layer.Digest] = true
+	}
+
+	for _, layer := range newImage.LayerDetails {
+		if oldLayers[layer.Digest] {
+			diff.SharedLayers++
+			diff.SharedSize += layer.Size
+		}
+	}
+
+	return diff
+}
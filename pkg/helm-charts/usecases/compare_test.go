@@ -0,0 +1,145 @@
+package usecases_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+func TestUsecaseHelmService_CompareHelmCharts(t *testing.T) {
+	layer := func(digest string, size int64) domain.ImageLayer {
+		return domain.ImageLayer{Digest: digest, Size: size}
+	}
+
+	oldChart := &domain.ChartScanResult{
+		Chart: &domain.ChartDetails{Name: "app", Version: "1.0.0"},
+		Images: []*domain.ImageDetails{
+			{
+				Reference: "index.docker.io/library/nginx:1.24", Digest: "sha256:n124", Size: 30, Layers: 2,
+				LayerDetails: []domain.ImageLayer{layer("sha256:base", 20), layer("sha256:n124", 10)},
+			},
+			{Reference: "index.docker.io/library/redis:7", Digest: "sha256:r7", Size: 50, Layers: 1},
+			{Reference: "index.docker.io/library/busybox:1.36", Digest: "sha256:b136", Size: 5, Layers: 1},
+		},
+	}
+
+	newChart := &domain.ChartScanResult{
+		Chart: &domain.ChartDetails{Name: "app", Version: "2.0.0"},
+		Images: []*domain.ImageDetails{
+			{
+				Reference: "index.docker.io/library/nginx:1.25", Digest: "sha256:n125", Size: 45, Layers: 3,
+				LayerDetails: []domain.ImageLayer{layer("sha256:base", 20), layer("sha256:n125", 15), layer("sha256:extra", 10)},
+			},
+			{Reference: "index.docker.io/library/redis:7", Digest: "sha256:r7", Size: 50, Layers: 1},
+			{Reference: "ghcr.io/example/exporter@sha256:e1", Digest: "sha256:e1", Size: 8, Layers: 1},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		input       *domain.CompareInput
+		failChart   string
+		wantErr     bool
+		wantSummary domain.CompareSummary
+		wantDiffs   []domain.ImageDiff
+	}{
+		{
+			name: "success: added, removed and changed images",
+			input: &domain.CompareInput{
+				Old: domain.HelmLinkInput{Path: "https://github.com/example/app-1.0.0.tgz"},
+				New: domain.HelmLinkInput{Path: "https://github.com/example/app-2.0.0.tgz"},
+			},
+			wantSummary: domain.CompareSummary{Added: 1, Removed: 1, Changed: 1, Unchanged: 1, OldSize: 85, NewSize: 103, SizeDelta: 18},
+			wantDiffs: []domain.ImageDiff{
+				{
+					Repository: "index.docker.io/library/nginx", Change: domain.ImageChangeChanged,
+					OldReference: "index.docker.io/library/nginx:1.24", NewReference: "index.docker.io/library/nginx:1.25",
+					OldDigest: "sha256:n124", NewDigest: "sha256:n125",
+					OldSize: 30, NewSize: 45, SizeDelta: 15, OldLayers: 2, NewLayers: 3, LayersDelta: 1,
+					SharedLayers: 1, SharedSize: 20,
+				},
+				{
+					Repository: "index.docker.io/library/redis", Change: domain.ImageChangeUnchanged,
+					OldReference: "index.docker.io/library/redis:7", NewReference: "index.docker.io/library/redis:7",
+					OldDigest: "sha256:r7", NewDigest: "sha256:r7",
+					OldSize: 50, NewSize: 50, OldLayers: 1, NewLayers: 1,
+				},
+				{
+					Repository: "ghcr.io/example/exporter", Change: domain.ImageChangeAdded,
+					NewReference: "ghcr.io/example/exporter@sha256:e1", NewDigest: "sha256:e1",
+					NewSize: 8, SizeDelta: 8, NewLayers: 1, LayersDelta: 1,
+				},
+				{
+					Repository: "index.docker.io/library/busybox", Change: domain.ImageChangeRemoved,
+					OldReference: "index.docker.io/library/busybox:1.36", OldDigest: "sha256:b136",
+					OldSize: 5, SizeDelta: -5, OldLayers: 1, LayersDelta: -1,
+				},
+			},
+		},
+		{
+			name: "fail: untrusted new chart",
+			input: &domain.CompareInput{
+				Old: domain.HelmLinkInput{Path: "https://github.com/example/app-1.0.0.tgz"},
+				New: domain.HelmLinkInput{Path: "https://evil.example.com/app-2.0.0.tgz"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: old chart cannot be scanned",
+			input: &domain.CompareInput{
+				Old: domain.HelmLinkInput{Path: "https://github.com/example/app-1.0.0.tgz"},
+				New: domain.HelmLinkInput{Path: "https://github.com/example/app-2.0.0.tgz"},
+			},
+			failChart: "https://github.com/example/app-1.0.0.tgz",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, mock := initializeMocks()
+
+			mock.Helm.MockProcessHelmChartBatchFn = func(_ context.Context, inputs []*domain.HelmLinkInput) []*domain.BatchChartResult {
+				results := []*domain.BatchChartResult{{Index: 0, Result: oldChart}, {Index: 1, Result: newChart}}
+
+				for i, input := range inputs {
+					if input.Path == tt.failChart {
+						results[i] = &domain.BatchChartResult{Index: i, Error: "failed to download Helm chart"}
+					}
+				}
+
+				return results
+			}
+
+			got, err := u.CompareHelmCharts(context.Background(), tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UsecaseHelmService.CompareHelmCharts() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if *got.Summary != tt.wantSummary {
+				t.Errorf("UsecaseHelmService.CompareHelmCharts() summary = %+v, want %+v", got.Summary, tt.wantSummary)
+			}
+
+			if got.Old.Version != "1.0.0" || got.New.Version != "2.0.0" {
+				t.Errorf("UsecaseHelmService.CompareHelmCharts() charts = %+v and %+v", got.Old, got.New)
+			}
+
+			if len(got.Images) != len(tt.wantDiffs) {
+				t.Fatalf("UsecaseHelmService.CompareHelmCharts() returned %d images, want %d", len(got.Images), len(tt.wantDiffs))
+			}
+
+			for i, diff := range got.Images {
+				if !reflect.DeepEqual(*diff, tt.wantDiffs[i]) {
+					t.Errorf("UsecaseHelmService.CompareHelmCharts() image %d = %+v, want %+v", i, *diff, tt.wantDiffs[i])
+				}
+			}
+		})
+	}
+}
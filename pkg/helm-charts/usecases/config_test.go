@@ -11,12 +11,12 @@ type Mock struct {
 	Helm *mock.HelmMock
 }
 
-func initializeMocks() (*usecases.UsecaseHelmService, *Mock) {
+func initializeMocks(opts ...usecases.Option) (*usecases.UsecaseHelmService, *Mock) {
 	fakeHelm := mock.NewHelmServiceMock()
 
 	infrastructure := infrastructure.NewInfrastructureInteractor(fakeHelm)
 
-	usecases := usecases.NewUsecaseHelmImpl(*infrastructure)
+	usecases := usecases.NewUsecaseHelmImpl(*infrastructure, opts...)
 
 	return usecases, &Mock{
 		Helm: fakeHelm,
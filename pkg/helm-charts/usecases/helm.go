@@ -2,6 +2,9 @@ package usecases
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"strings"
 
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/application/helpers"
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
@@ -11,11 +14,101 @@ import (
 
 var tracer = otel.Tracer("github.com/robinmuhia/helm-charts/pkg/helm-charts/usecases")
 
-func (u *UsecaseHelmService) ProcessHelmChart(ctx context.Context, urlLink *domain.HelmLinkInput) ([]*domain.ImageDetails, error) {
+// validateRenderOptions checks that values files come from trusted sources and
+// returns a sanitized copy of the options.
+func validateRenderOptions(options domain.RenderOptions) (domain.RenderOptions, error) {
+	validURLs := make([]string, 0, len(options.ValuesURLs))
+
+	for _, valuesURL := range options.ValuesURLs {
+		validURL, err := helpers.ValidateURL(valuesURL)
+		if err != nil {
+			return options, err
+		}
+
+		if strings.HasPrefix(validURL, "oci://") {
+			return options, fmt.Errorf("values files must be served over HTTP/HTTPS: %s", valuesURL)
+		}
+
+		validURLs = append(validURLs, validURL)
+	}
+
+	for key := range options.Set {
+		if key == "" || strings.Contains(key, "=") {
+			return options, fmt.Errorf("invalid set key: %q", key)
+		}
+	}
+
+	options.ValuesURLs = validURLs
+
+	return options, nil
+}
+
+// validateHelmLinkInput checks that the input identifies a chart from a trusted source
+// and returns a sanitized copy of it.
+func validateHelmLinkInput(urlLink *domain.HelmLinkInput) (*domain.HelmLinkInput, error) {
+	input := *urlLink
+
+	options, err := validateRenderOptions(input.RenderOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	input.RenderOptions = options
+
+	if input.RepoURL == "" {
+		validPath, err := helpers.ValidateURL(input.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		input.Path = validPath
+
+		return &input, nil
+	}
+
+	if input.Chart == "" {
+		return nil, fmt.Errorf("chart name is required when repo_url is set")
+	}
+
+	validRepoURL, err := helpers.ValidateURL(input.RepoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	input.RepoURL = validRepoURL
+
+	return &input, nil
+}
+
+func (u *UsecaseHelmService) ProcessHelmChart(ctx context.Context, urlLink *domain.HelmLinkInput) (*domain.ChartScanResult, error) {
 	ctx, span := tracer.Start(ctx, "ProcessHelmChart")
 	defer span.End()
 
-	validPath, err := helpers.ValidateURL(urlLink.Path)
+	input, err := validateHelmLinkInput(urlLink)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+
+		return nil, err
+	}
+
+	result, err := u.Infrastructure.Helm.ProcessHelmChart(ctx, input)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ProcessHelmChartArchive processes a packaged chart that was uploaded directly
+func (u *UsecaseHelmService) ProcessHelmChartArchive(ctx context.Context, archive io.Reader) (*domain.ChartScanResult, error) {
+	ctx, span := tracer.Start(ctx, "ProcessHelmChartArchive")
+	defer span.End()
+
+	result, err := u.Infrastructure.Helm.ProcessHelmChartArchive(ctx, archive)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		span.RecordError(err)
@@ -23,7 +116,31 @@ func (u *UsecaseHelmService) ProcessHelmChart(ctx context.Context, urlLink *doma
 		return nil, err
 	}
 
-	images, err := u.Infrastructure.Helm.ProcessHelmChart(ctx, validPath)
+	return result, nil
+}
+
+// PurgeImageCache removes cached image details, for a single image or for every image when image is empty
+func (u *UsecaseHelmService) PurgeImageCache(ctx context.Context, image string) (*domain.CachePurgeResult, error) {
+	ctx, span := tracer.Start(ctx, "PurgeImageCache")
+	defer span.End()
+
+	result, err := u.Infrastructure.Helm.PurgeImageCache(ctx, image)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// PurgeChartCache removes every cached chart archive and rendered template
+func (u *UsecaseHelmService) PurgeChartCache(ctx context.Context) (*domain.CachePurgeResult, error) {
+	ctx, span := tracer.Start(ctx, "PurgeChartCache")
+	defer span.End()
+
+	result, err := u.Infrastructure.Helm.PurgeChartCache(ctx)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		span.RecordError(err)
@@ -31,5 +148,5 @@ func (u *UsecaseHelmService) ProcessHelmChart(ctx context.Context, urlLink *doma
 		return nil, err
 	}
 
-	return images, nil
+	return result, nil
 }
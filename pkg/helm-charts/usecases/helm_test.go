@@ -3,6 +3,8 @@ package usecases_test
 import (
 	"context"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
@@ -39,6 +41,93 @@ func TestUsecaseHelmService_ProcessHelmChart(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "success: process chart from repository index",
+			args: args{
+				ctx: context.Background(),
+				urlLink: &domain.HelmLinkInput{
+					RepoURL: "https://charts.bitnami.com/bitnami",
+					Chart:   "redis",
+					Version: "~20.6",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "success: process chart with values",
+			args: args{
+				ctx: context.Background(),
+				urlLink: &domain.HelmLinkInput{
+					Path: "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz",
+					RenderOptions: domain.RenderOptions{
+						Values:     map[string]interface{}{"replicaCount": 2},
+						ValuesURLs: []string{"https://github.com/helm/examples/raw/main/charts/hello-world/values.yaml"},
+						Set:        map[string]string{"image.tag": "1.17.0"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "fail: untrusted values url",
+			args: args{
+				ctx: context.Background(),
+				urlLink: &domain.HelmLinkInput{
+					Path: "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz",
+					RenderOptions: domain.RenderOptions{
+						ValuesURLs: []string{"https://values.example.com/values.yaml"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: oci values url",
+			args: args{
+				ctx: context.Background(),
+				urlLink: &domain.HelmLinkInput{
+					Path: "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz",
+					RenderOptions: domain.RenderOptions{
+						ValuesURLs: []string{"oci://ghcr.io/helm/values:1.0.0"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: invalid set key",
+			args: args{
+				ctx: context.Background(),
+				urlLink: &domain.HelmLinkInput{
+					Path: "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz",
+					RenderOptions: domain.RenderOptions{
+						Set: map[string]string{"image.tag=1.17.0": ""},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: repository without chart name",
+			args: args{
+				ctx: context.Background(),
+				urlLink: &domain.HelmLinkInput{
+					RepoURL: "https://charts.bitnami.com/bitnami",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail: untrusted repository",
+			args: args{
+				ctx: context.Background(),
+				urlLink: &domain.HelmLinkInput{
+					RepoURL: "https://charts.example.com",
+					Chart:   "redis",
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "fail: fail to process chart",
 			args: args{
@@ -56,7 +145,7 @@ func TestUsecaseHelmService_ProcessHelmChart(t *testing.T) {
 			u, mock := initializeMocks()
 
 			if tt.name == "fail: fail to process chart" {
-				mock.Helm.MockProcessHelmChartFn = func(_ context.Context, _ string) ([]*domain.ImageDetails, error) {
+				mock.Helm.MockProcessHelmChartFn = func(_ context.Context, _ *domain.HelmLinkInput) (*domain.ChartScanResult, error) {
 					return nil, fmt.Errorf("error")
 				}
 			}
@@ -69,3 +158,132 @@ func TestUsecaseHelmService_ProcessHelmChart(t *testing.T) {
 		})
 	}
 }
+
+func TestUsecaseHelmService_ProcessHelmChartArchive(t *testing.T) {
+	type args struct {
+		ctx     context.Context
+		archive io.Reader
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "success: process uploaded chart",
+			args: args{
+				ctx:     context.Background(),
+				archive: strings.NewReader("fake tarball content"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "fail: fail to process chart",
+			args: args{
+				ctx:     context.Background(),
+				archive: strings.NewReader("fake tarball content"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, mock := initializeMocks()
+
+			if tt.name == "fail: fail to process chart" {
+				mock.Helm.MockProcessHelmChartArchiveFn = func(_ context.Context, _ io.Reader) (*domain.ChartScanResult, error) {
+					return nil, fmt.Errorf("error")
+				}
+			}
+
+			_, err := u.ProcessHelmChartArchive(tt.args.ctx, tt.args.archive)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UsecaseHelmService.ProcessHelmChartArchive() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+		})
+	}
+}
+
+func TestUsecaseHelmService_PurgeImageCache(t *testing.T) {
+	type args struct {
+		ctx   context.Context
+		image string
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "success: purge one image",
+			args: args{
+				ctx:   context.Background(),
+				image: "nginx:1.16.0",
+			},
+			wantErr: false,
+		},
+		{
+			name: "fail: fail to purge cache",
+			args: args{
+				ctx: context.Background(),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, mock := initializeMocks()
+
+			if tt.name == "fail: fail to purge cache" {
+				mock.Helm.MockPurgeImageCacheFn = func(_ context.Context, _ string) (*domain.CachePurgeResult, error) {
+					return nil, fmt.Errorf("error")
+				}
+			}
+
+			_, err := u.PurgeImageCache(tt.args.ctx, tt.args.image)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UsecaseHelmService.PurgeImageCache() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+		})
+	}
+}
+
+func TestUsecaseHelmService_PurgeChartCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{
+			name:    "success: purge charts",
+			wantErr: false,
+		},
+		{
+			name:    "fail: fail to purge cache",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, mock := initializeMocks()
+
+			if tt.name == "fail: fail to purge cache" {
+				mock.Helm.MockPurgeChartCacheFn = func(_ context.Context) (*domain.CachePurgeResult, error) {
+					return nil, fmt.Errorf("error")
+				}
+			}
+
+			_, err := u.PurgeChartCache(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UsecaseHelmService.PurgeChartCache() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	// DefaultScanConcurrency is the number of asynchronous scans run at the same time
+	DefaultScanConcurrency = 2
+
+	// DefaultScanRetention is how long finished scans are kept
+	DefaultScanRetention = time.Hour
+
+	// DefaultMaxQueuedScans is the number of scans that may wait to run, and of finished scans kept
+	DefaultMaxQueuedScans = 100
+)
+
+var (
+	// ErrScanNotFound is returned for unknown, or expired, scan IDs
+	ErrScanNotFound = errors.New("scan not found")
+
+	// ErrScanQueueFull is returned when a scan is submitted while the queue is full
+	ErrScanQueueFull = errors.New("too many scans queued")
+)
+
+// scanJob is an asynchronous scan and the means to cancel it
+type scanJob struct {
+	job    domain.ScanJob
+	input  *domain.HelmLinkInput
+	cancel context.CancelFunc
+}
+
+// scanQueue runs asynchronous scans in submission order, at most concurrency at a time,
+// and keeps finished scans for retention.
+type scanQueue struct {
+	concurrency int
+	retention   time.Duration
+
+	mu      sync.Mutex
+	jobs    map[string]*scanJob
+	queue   []*scanJob
+	running int
+}
+
+// newScanQueue creates an empty scan queue. Workers only run while scans are queued.
+func newScanQueue(concurrency int, retention time.Duration) *scanQueue {
+	return &scanQueue{
+		concurrency: max(concurrency, 1),
+		retention:   retention,
+		jobs:        map[string]*scanJob{},
+	}
+}
+
+// newScanID returns a random scan ID
+func newScanID() (string, error) {
+	id := make([]byte, 16)
+
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// prune removes finished scans older than the retention period. The caller holds q.mu.
+func (q *scanQueue) prune(now time.Time) {
+	for id, job := range q.jobs {
+		if job.job.FinishedAt != nil && now.Sub(*job.job.FinishedAt) > q.retention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// dropFinished removes the oldest finished scans beyond limit. The caller holds q.mu.
+func (q *scanQueue) dropFinished(limit int) {
+	var finished []*scanJob
+
+	for _, job := range q.jobs {
+		if job.job.FinishedAt != nil {
+			finished = append(finished, job)
+		}
+	}
+
+	if len(finished) <= limit {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].job.FinishedAt.Before(*finished[j].job.FinishedAt)
+	})
+
+	for _, job := range finished[:len(finished)-limit] {
+		delete(q.jobs, job.job.ID)
+	}
+}
+
+// SubmitScan validates the input and queues the chart for scanning in the background. Scans
+// submitted while the maximum number of scans are queued fail with ErrScanQueueFull.
+func (u *UsecaseHelmService) SubmitScan(ctx context.Context, urlLink *domain.HelmLinkInput) (*domain.ScanJob, error) {
+	_, span := tracer.Start(ctx, "SubmitScan")
+	defer span.End()
+
+	input, err := validateHelmLinkInput(urlLink)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+
+		return nil, err
+	}
+
+	id, err := newScanID()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+
+		return nil, err
+	}
+
+	q := u.scans
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+
+	q.prune(now)
+	q.dropFinished(u.maxQueuedScans)
+
+	if len(q.queue) >= u.maxQueuedScans {
+		err := fmt.Errorf("%w: %d scans are waiting to run", ErrScanQueueFull, len(q.queue))
+
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+
+		return nil, err
+	}
+
+	job := &scanJob{
+		job: domain.ScanJob{
+			ID:        id,
+			Status:    domain.ScanStatusQueued,
+			CreatedAt: now,
+		},
+		input: input,
+	}
+
+	q.jobs[id] = job
+	q.queue = append(q.queue, job)
+
+	if q.running < q.concurrency {
+		q.running++
+
+		go u.runScans()
+	}
+
+	snapshot := job.job
+
+	return &snapshot, nil
+}
+
+// runScans runs queued scans until the queue is empty.
+func (u *UsecaseHelmService) runScans() {
+	q := u.scans
+
+	for {
+		q.mu.Lock()
+
+		if len(q.queue) == 0 {
+			q.running--
+			q.mu.Unlock()
+
+			return
+		}
+
+		job := q.queue[0]
+		q.queue = q.queue[1:]
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		started := time.Now()
+
+		job.cancel = cancel
+		job.job.Status = domain.ScanStatusRunning
+		job.job.StartedAt = &started
+
+		q.mu.Unlock()
+
+		u.runScan(ctx, job)
+
+		cancel()
+	}
+}
+
+// runScan processes the chart of a scan job and records its progress and outcome.
+func (u *UsecaseHelmService) runScan(ctx context.Context, job *scanJob) {
+	q := u.scans
+
+	ctx, span := tracer.Start(ctx, "RunScan")
+	defer span.End()
+
+	ctx = domain.WithScanEvents(ctx, func(event *domain.ScanEvent) {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		job.job.Progress.Stage = event.Type
+
+		switch event.Type {
+		case domain.ScanEventImagesDiscovered:
+			job.job.Progress.ImagesTotal = event.Images
+		case domain.ScanEventImageScanned:
+			job.job.Progress.ImagesDone++
+		}
+	})
+
+	result, err := u.Infrastructure.Helm.ProcessHelmChart(ctx, job.input)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	finished := time.Now()
+
+	job.job.FinishedAt = &finished
+
+	switch {
+	case job.job.Status == domain.ScanStatusCanceled:
+		job.job.Result = result
+
+		if err != nil {
+			job.job.Error = err.Error()
+		}
+	case err != nil:
+		job.job.Status = domain.ScanStatusFailed
+		job.job.Error = err.Error()
+	default:
+		job.job.Status = domain.ScanStatusSucceeded
+		job.job.Result = result
+	}
+}
+
+// GetScan returns the status, progress and, once finished, the results of a scan.
+func (u *UsecaseHelmService) GetScan(_ context.Context, id string) (*domain.ScanJob, error) {
+	q := u.scans
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.prune(time.Now())
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, ErrScanNotFound
+	}
+
+	snapshot := job.job
+
+	return &snapshot, nil
+}
+
+// CancelScan cancels a queued or running scan. Finished scans are removed along with their results.
+func (u *UsecaseHelmService) CancelScan(_ context.Context, id string) (*domain.ScanJob, error) {
+	q := u.scans
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.prune(time.Now())
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, ErrScanNotFound
+	}
+
+	switch job.job.Status {
+	case domain.ScanStatusQueued:
+		finished := time.Now()
+
+		job.job.Status = domain.ScanStatusCanceled
+		job.job.FinishedAt = &finished
+
+		for i, queued := range q.queue {
+			if queued == job {
+				q.queue = append(q.queue[:i], q.queue[i+1:]...)
+				break
+			}
+		}
+	case domain.ScanStatusRunning:
+		job.job.Status = domain.ScanStatusCanceled
+		job.cancel()
+	default:
+		delete(q.jobs, id)
+	}
+
+	snapshot := job.job
+
+	return &snapshot, nil
+}
@@ -0,0 +1,341 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/usecases"
+)
+
+const testChartURL = "https://github.com/helm/examples/releases/download/hello-world-0.1.0/hello-world-0.1.0.tgz"
+
+// waitForScan polls a scan until it has finished with, or is running in, one of the given statuses
+func waitForScan(t *testing.T, u *usecases.UsecaseHelmService, id string, statuses ...domain.ScanStatus) *domain.ScanJob {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		job, err := u.GetScan(context.Background(), id)
+		if err != nil {
+			t.Fatalf("UsecaseHelmService.GetScan() error = %v", err)
+		}
+
+		active := job.Status == domain.ScanStatusQueued || job.Status == domain.ScanStatusRunning
+
+		for _, status := range statuses {
+			if job.Status == status && (active || job.FinishedAt != nil) {
+				return job
+			}
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("scan %s did not reach %v", id, statuses)
+
+	return nil
+}
+
+func TestUsecaseHelmService_SubmitScan(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        *domain.HelmLinkInput
+		processErr   error
+		wantErr      bool
+		wantStatus   domain.ScanStatus
+		wantProgress domain.ScanProgress
+	}{
+		{
+			name:       "success: scan succeeds with progress",
+			input:      &domain.HelmLinkInput{Path: testChartURL},
+			wantStatus: domain.ScanStatusSucceeded,
+			wantProgress: domain.ScanProgress{
+				Stage:       domain.ScanEventImageScanned,
+				ImagesTotal: 2,
+				ImagesDone:  2,
+			},
+		},
+		{
+			name:       "success: scan fails",
+			input:      &domain.HelmLinkInput{Path: testChartURL},
+			processErr: fmt.Errorf("failed to download Helm chart"),
+			wantStatus: domain.ScanStatusFailed,
+			wantProgress: domain.ScanProgress{
+				Stage:       domain.ScanEventImageScanned,
+				ImagesTotal: 2,
+				ImagesDone:  2,
+			},
+		},
+		{
+			name:    "fail: untrusted chart",
+			input:   &domain.HelmLinkInput{Path: "https://evil.example.com/chart.tgz"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, mock := initializeMocks()
+
+			mock.Helm.MockProcessHelmChartFn = func(ctx context.Context, _ *domain.HelmLinkInput) (*domain.ChartScanResult, error) {
+				domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventImagesDiscovered, Images: 2})
+				domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventImageScanned})
+				domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventImageScanned})
+
+				if tt.processErr != nil {
+					return nil, tt.processErr
+				}
+
+				return &domain.ChartScanResult{Summary: &domain.ScanSummary{Total: 2, Succeeded: 2}}, nil
+			}
+
+			job, err := u.SubmitScan(context.Background(), tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UsecaseHelmService.SubmitScan() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if job.ID == "" || job.Status != domain.ScanStatusQueued {
+				t.Errorf("UsecaseHelmService.SubmitScan() = %+v, want a queued scan", job)
+			}
+
+			got := waitForScan(t, u, job.ID, tt.wantStatus)
+
+			if got.Progress != tt.wantProgress || got.StartedAt == nil || got.FinishedAt == nil {
+				t.Errorf("UsecaseHelmService.GetScan() = %+v, want progress %+v", got, tt.wantProgress)
+			}
+
+			if (got.Result != nil) != (tt.processErr == nil) || (got.Error != "") != (tt.processErr != nil) {
+				t.Errorf("UsecaseHelmService.GetScan() result = %+v, error = %q", got.Result, got.Error)
+			}
+		})
+	}
+}
+
+func TestUsecaseHelmService_scanConcurrency(t *testing.T) {
+	u, mock := initializeMocks(usecases.WithScanQueue(2, time.Hour))
+
+	var running, peak atomic.Int64
+
+	mock.Helm.MockProcessHelmChartFn = func(_ context.Context, _ *domain.HelmLinkInput) (*domain.ChartScanResult, error) {
+		current := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			previous := peak.Load()
+			if current <= previous || peak.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		return &domain.ChartScanResult{}, nil
+	}
+
+	var ids []string
+
+	for range 6 {
+		job, err := u.SubmitScan(context.Background(), &domain.HelmLinkInput{Path: testChartURL})
+		if err != nil {
+			t.Fatalf("UsecaseHelmService.SubmitScan() error = %v", err)
+		}
+
+		ids = append(ids, job.ID)
+	}
+
+	for _, id := range ids {
+		waitForScan(t, u, id, domain.ScanStatusSucceeded)
+	}
+
+	if got := peak.Load(); got != 2 {
+		t.Errorf("ran %d scans at the same time, want 2", got)
+	}
+}
+
+func TestUsecaseHelmService_CancelScan(t *testing.T) {
+	u, mock := initializeMocks(usecases.WithScanQueue(1, time.Hour))
+
+	started := make(chan struct{}, 2)
+
+	mock.Helm.MockProcessHelmChartFn = func(ctx context.Context, _ *domain.HelmLinkInput) (*domain.ChartScanResult, error) {
+		started <- struct{}{}
+
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	}
+
+	running, err := u.SubmitScan(context.Background(), &domain.HelmLinkInput{Path: testChartURL})
+	if err != nil {
+		t.Fatalf("UsecaseHelmService.SubmitScan() error = %v", err)
+	}
+
+	queued, err := u.SubmitScan(context.Background(), &domain.HelmLinkInput{Path: testChartURL})
+	if err != nil {
+		t.Fatalf("UsecaseHelmService.SubmitScan() error = %v", err)
+	}
+
+	<-started
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus domain.ScanStatus
+		wantErr    error
+	}{
+		{
+			name:       "success: cancel queued scan",
+			id:         queued.ID,
+			wantStatus: domain.ScanStatusCanceled,
+		},
+		{
+			name:       "success: cancel running scan",
+			id:         running.ID,
+			wantStatus: domain.ScanStatusCanceled,
+		},
+		{
+			name:    "fail: unknown scan",
+			id:      "unknown",
+			wantErr: usecases.ErrScanNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := u.CancelScan(context.Background(), tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UsecaseHelmService.CancelScan() error = %v, want %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.Status != tt.wantStatus {
+				t.Errorf("UsecaseHelmService.CancelScan() status = %v, want %v", got.Status, tt.wantStatus)
+			}
+
+			finished := waitForScan(t, u, tt.id, tt.wantStatus)
+			if finished.FinishedAt == nil {
+				t.Errorf("UsecaseHelmService.GetScan() = %+v, want a finished scan", finished)
+			}
+		})
+	}
+
+	if len(started) != 0 {
+		t.Errorf("canceled queued scan was started")
+	}
+
+	if _, err := u.CancelScan(context.Background(), running.ID); err != nil {
+		t.Errorf("UsecaseHelmService.CancelScan() of a finished scan error = %v", err)
+	}
+
+	if _, err := u.GetScan(context.Background(), running.ID); !errors.Is(err, usecases.ErrScanNotFound) {
+		t.Errorf("UsecaseHelmService.GetScan() of a removed scan error = %v, want %v", err, usecases.ErrScanNotFound)
+	}
+}
+
+func TestUsecaseHelmService_scanRetention(t *testing.T) {
+	u, _ := initializeMocks(usecases.WithScanQueue(1, 50*time.Millisecond))
+
+	job, err := u.SubmitScan(context.Background(), &domain.HelmLinkInput{Path: testChartURL})
+	if err != nil {
+		t.Fatalf("UsecaseHelmService.SubmitScan() error = %v", err)
+	}
+
+	waitForScan(t, u, job.ID, domain.ScanStatusSucceeded)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := u.GetScan(context.Background(), job.ID); !errors.Is(err, usecases.ErrScanNotFound) {
+		t.Errorf("UsecaseHelmService.GetScan() of an expired scan error = %v, want %v", err, usecases.ErrScanNotFound)
+	}
+}
+
+func TestUsecaseHelmService_maxQueuedScans(t *testing.T) {
+	u, mock := initializeMocks(usecases.WithScanQueue(1, time.Hour), usecases.WithMaxQueuedScans(2))
+
+	started := make(chan struct{}, 8)
+	release := make(chan struct{})
+
+	mock.Helm.MockProcessHelmChartFn = func(ctx context.Context, _ *domain.HelmLinkInput) (*domain.ChartScanResult, error) {
+		started <- struct{}{}
+
+		select {
+		case <-release:
+			return &domain.ChartScanResult{}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	submit := func() (*domain.ScanJob, error) {
+		return u.SubmitScan(context.Background(), &domain.HelmLinkInput{Path: testChartURL})
+	}
+
+	running, err := submit()
+	if err != nil {
+		t.Fatalf("UsecaseHelmService.SubmitScan() error = %v", err)
+	}
+
+	<-started
+
+	var queued []*domain.ScanJob
+
+	for range 2 {
+		job, err := submit()
+		if err != nil {
+			t.Fatalf("UsecaseHelmService.SubmitScan() error = %v", err)
+		}
+
+		queued = append(queued, job)
+	}
+
+	if _, err := submit(); !errors.Is(err, usecases.ErrScanQueueFull) {
+		t.Fatalf("UsecaseHelmService.SubmitScan() with a full queue error = %v, want %v", err, usecases.ErrScanQueueFull)
+	}
+
+	if _, err := u.CancelScan(context.Background(), queued[0].ID); err != nil {
+		t.Fatalf("UsecaseHelmService.CancelScan() error = %v", err)
+	}
+
+	last, err := submit()
+	if err != nil {
+		t.Fatalf("UsecaseHelmService.SubmitScan() after a queued scan was canceled error = %v", err)
+	}
+
+	close(release)
+
+	for _, job := range []*domain.ScanJob{running, queued[1], last} {
+		waitForScan(t, u, job.ID, domain.ScanStatusSucceeded)
+	}
+
+	// four scans have finished, only the two most recent are kept
+	if _, err := submit(); err != nil {
+		t.Fatalf("UsecaseHelmService.SubmitScan() error = %v", err)
+	}
+
+	for _, job := range []*domain.ScanJob{queued[0], running} {
+		if _, err := u.GetScan(context.Background(), job.ID); !errors.Is(err, usecases.ErrScanNotFound) {
+			t.Errorf("UsecaseHelmService.GetScan() of an old finished scan error = %v, want %v", err, usecases.ErrScanNotFound)
+		}
+	}
+
+	for _, job := range []*domain.ScanJob{queued[1], last} {
+		if _, err := u.GetScan(context.Background(), job.ID); err != nil {
+			t.Errorf("UsecaseHelmService.GetScan() of a recent finished scan error = %v", err)
+		}
+	}
+}
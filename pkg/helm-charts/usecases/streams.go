@@ -0,0 +1,51 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// streamBuffer is the number of scan events buffered for a slow reader before lookups wait
+const streamBuffer = 16
+
+// StreamHelmChart validates the input and scans the chart in the background, sending its
+// progress on the returned channel. The stream ends with a completed event holding the result,
+// or a failed event holding the error, and the channel is then closed. Canceling ctx stops
+// the scan; the final event is only sent while ctx is not done.
+func (u *UsecaseHelmService) StreamHelmChart(ctx context.Context, urlLink *domain.HelmLinkInput) (<-chan *domain.ScanEvent, error) {
+	_, span := tracer.Start(ctx, "StreamHelmChart")
+	defer span.End()
+
+	if _, err := validateHelmLinkInput(urlLink); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+
+		return nil, err
+	}
+
+	events := make(chan *domain.ScanEvent, streamBuffer)
+
+	send := func(event *domain.ScanEvent) {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		defer close(events)
+
+		result, err := u.ProcessHelmChart(domain.WithScanEvents(ctx, send), urlLink)
+		if err != nil {
+			send(&domain.ScanEvent{Type: domain.ScanEventFailed, Error: err.Error()})
+
+			return
+		}
+
+		send(&domain.ScanEvent{Type: domain.ScanEventCompleted, Result: result})
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,140 @@
+package usecases_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/domain"
+)
+
+func TestUsecaseHelmService_StreamHelmChart(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      *domain.HelmLinkInput
+		processErr error
+		wantErr    bool
+		wantEvents []domain.ScanEventType
+	}{
+		{
+			name:  "success: stream ends with the result",
+			input: &domain.HelmLinkInput{Path: testChartURL},
+			wantEvents: []domain.ScanEventType{
+				domain.ScanEventChartDownloaded,
+				domain.ScanEventChartRendered,
+				domain.ScanEventImagesDiscovered,
+				domain.ScanEventImageScanned,
+				domain.ScanEventImageScanned,
+				domain.ScanEventCompleted,
+			},
+		},
+		{
+			name:       "success: stream ends with the error",
+			input:      &domain.HelmLinkInput{Path: testChartURL},
+			processErr: fmt.Errorf("failed to download Helm chart"),
+			wantEvents: []domain.ScanEventType{domain.ScanEventFailed},
+		},
+		{
+			name:    "fail: untrusted chart",
+			input:   &domain.HelmLinkInput{Path: "https://evil.example.com/chart.tgz"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, mock := initializeMocks()
+
+			mock.Helm.MockProcessHelmChartFn = func(ctx context.Context, _ *domain.HelmLinkInput) (*domain.ChartScanResult, error) {
+				if tt.processErr != nil {
+					return nil, tt.processErr
+				}
+
+				domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventChartDownloaded})
+				domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventChartRendered})
+				domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventImagesDiscovered, Images: 2})
+				domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventImageScanned})
+				domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventImageScanned})
+
+				return &domain.ChartScanResult{Summary: &domain.ScanSummary{Total: 2, Succeeded: 2}}, nil
+			}
+
+			events, err := u.StreamHelmChart(context.Background(), tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UsecaseHelmService.StreamHelmChart() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			var got []*domain.ScanEvent
+
+			for event := range events {
+				got = append(got, event)
+			}
+
+			if len(got) != len(tt.wantEvents) {
+				t.Fatalf("UsecaseHelmService.StreamHelmChart() sent %d events, want %d", len(got), len(tt.wantEvents))
+			}
+
+			for i, event := range got {
+				if event.Type != tt.wantEvents[i] {
+					t.Errorf("UsecaseHelmService.StreamHelmChart() event %d = %s, want %s", i, event.Type, tt.wantEvents[i])
+				}
+			}
+
+			last := got[len(got)-1]
+			if (last.Result != nil) != (tt.processErr == nil) || (last.Error != "") != (tt.processErr != nil) {
+				t.Errorf("UsecaseHelmService.StreamHelmChart() final event = %+v", last)
+			}
+		})
+	}
+}
+
+func TestUsecaseHelmService_StreamHelmChartCanceled(t *testing.T) {
+	u, mock := initializeMocks()
+
+	mock.Helm.MockProcessHelmChartFn = func(ctx context.Context, _ *domain.HelmLinkInput) (*domain.ChartScanResult, error) {
+		// Nobody reads the stream, so these only return once the stream is canceled
+		for range 100 {
+			domain.EmitScanEvent(ctx, &domain.ScanEvent{Type: domain.ScanEventImageScanned})
+		}
+
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events, err := u.StreamHelmChart(ctx, &domain.HelmLinkInput{Path: testChartURL})
+	if err != nil {
+		t.Fatalf("UsecaseHelmService.StreamHelmChart() error = %v", err)
+	}
+
+	cancel()
+
+	// Give the scan time to run into the canceled stream before reading it
+	time.Sleep(50 * time.Millisecond)
+
+	deadline := time.After(5 * time.Second)
+	received := 0
+
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				if received >= 100 {
+					t.Errorf("UsecaseHelmService.StreamHelmChart() sent %d events after cancellation", received)
+				}
+
+				return
+			}
+
+			received++
+		case <-deadline:
+			t.Fatal("UsecaseHelmService.StreamHelmChart() did not close the stream after cancellation")
+		}
+	}
+}
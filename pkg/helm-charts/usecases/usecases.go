@@ -1,13 +1,55 @@
 package usecases
 
-import "github.com/robinmuhia/helm-charts/pkg/helm-charts/infrastructure"
+import (
+	"time"
+
+	"github.com/robinmuhia/helm-charts/pkg/helm-charts/infrastructure"
+)
 
 type UsecaseHelmService struct {
 	Infrastructure infrastructure.Infrastructure
+
+	scans          *scanQueue
+	maxQueuedScans int
+	maxBatchSize   int
+}
+
+// Option configures a UsecaseHelmService
+type Option func(*UsecaseHelmService)
+
+// WithScanQueue runs at most concurrency asynchronous scans at a time and keeps finished scans for retention
+func WithScanQueue(concurrency int, retention time.Duration) Option {
+	return func(u *UsecaseHelmService) {
+		u.scans = newScanQueue(concurrency, retention)
+	}
 }
 
-func NewUsecaseHelmImpl(infra infrastructure.Infrastructure) *UsecaseHelmService {
-	return &UsecaseHelmService{
+// WithMaxQueuedScans limits the number of asynchronous scans waiting to run. Submissions beyond it
+// are rejected, and only as many finished scans are kept, dropping the oldest first.
+func WithMaxQueuedScans(size int) Option {
+	return func(u *UsecaseHelmService) {
+		u.maxQueuedScans = max(size, 1)
+	}
+}
+
+// WithMaxBatchSize limits the number of charts scanned by a single batch request
+func WithMaxBatchSize(size int) Option {
+	return func(u *UsecaseHelmService) {
+		u.maxBatchSize = max(size, 1)
+	}
+}
+
+func NewUsecaseHelmImpl(infra infrastructure.Infrastructure, opts ...Option) *UsecaseHelmService {
+	u := &UsecaseHelmService{
 		Infrastructure: infra,
+		scans:          newScanQueue(DefaultScanConcurrency, DefaultScanRetention),
+		maxQueuedScans: DefaultMaxQueuedScans,
+		maxBatchSize:   DefaultMaxBatchSize,
 	}
+
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	return u
 }